@@ -0,0 +1,197 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// column 聚合和 Pluck 用的字段，单独的字段名加上引号（有别名时带上别名），表达式原样返回
+func (s *Scope) column(col string) string {
+	if q := s.qualifier(); q != "" {
+		return qualifyColumn(col, q)
+	}
+	if getFirstInvalidFieldNameCharIndex(col) < 0 {
+		return quoteFieldName(col)
+	}
+	return col
+}
+
+// aggregateReq 聚合查询，不带排序和分页
+func (s *Scope) aggregateReq(selects []string) *WhereReq {
+	return &WhereReq{
+		Unscoped:    s.unscoped,
+		OnlyTrashed: s.onlyTrashed,
+		SoftDelete:  s.m.SoftDelete,
+		Cond:        []Expr{s.condExpr()},
+		Alias:       s.qualifier(),
+		Joins:       s.joins,
+		Selects:     selects,
+		TableName:   s.GetTableName(),
+		Db:          s.db,
+		UseMaster:   s.useMaster,
+		EnableCache: s.cacheable(),
+	}
+}
+
+// aggregate 把 fn(col) 的结果扫描到 dest，先扫到对应的 sql.NullXxx，没有行（结果为 NULL）时 dest 置为零值
+func (s *Scope) aggregate(ctx context.Context, fn, col string, dest interface{}) error {
+	if err := s.condErr(); err != nil {
+		return err
+	}
+	req := s.aggregateReq([]string{fmt.Sprintf("%s(%s)", fn, s.column(col))})
+	if _, ok := dest.(sql.Scanner); ok {
+		// sql.NullInt64 等自己处理 NULL
+		return s.m.proxy.Find(s.callCtx(ctx), req, dest)
+	}
+	if d, ok := dest.(*time.Time); ok {
+		var v sql.NullTime
+		err := s.m.proxy.Find(s.callCtx(ctx), req, &v)
+		*d = v.Time
+		return err
+	}
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("dest required non-nil pointer, but got %T", dest)
+	}
+	el := dv.Elem()
+	switch el.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var v sql.NullInt64
+		err := s.m.proxy.Find(s.callCtx(ctx), req, &v)
+		el.SetInt(v.Int64)
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// 按字符串取，超过 int64 的无符号值也不会溢出
+		var v sql.NullString
+		if err := s.m.proxy.Find(s.callCtx(ctx), req, &v); err != nil {
+			return err
+		}
+		var n uint64
+		if v.Valid {
+			var err error
+			if n, err = strconv.ParseUint(v.String, 10, 64); err != nil {
+				return fmt.Errorf("scan %s(%s) into %T: %w", fn, col, dest, err)
+			}
+		}
+		el.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		var v sql.NullFloat64
+		err := s.m.proxy.Find(s.callCtx(ctx), req, &v)
+		el.SetFloat(v.Float64)
+		return err
+	case reflect.String:
+		var v sql.NullString
+		err := s.m.proxy.Find(s.callCtx(ctx), req, &v)
+		el.SetString(v.String)
+		return err
+	}
+	return fmt.Errorf("unsupported aggregate dest %T", dest)
+}
+
+// Sum 符合条件的行上 column 的和，column 可以是字段名或表达式，结果扫描到 dest，
+// dest 为 *int64、*float64、*string 等基础类型的指针，DECIMAL 列用 *string 取精确值；
+// 没有行时 dest 为零值，需要区分时用 *sql.NullInt64 等
+func (s *Scope) Sum(ctx context.Context, column string, dest interface{}) error {
+	return s.aggregate(ctx, "SUM", column, dest)
+}
+
+// Max column 的最大值，字符串、时间列用 *string、*time.Time，见 Sum
+func (s *Scope) Max(ctx context.Context, column string, dest interface{}) error {
+	return s.aggregate(ctx, "MAX", column, dest)
+}
+
+// Min column 的最小值，见 Max
+func (s *Scope) Min(ctx context.Context, column string, dest interface{}) error {
+	return s.aggregate(ctx, "MIN", column, dest)
+}
+
+// Avg column 的平均值，见 Sum
+func (s *Scope) Avg(ctx context.Context, column string, dest interface{}) error {
+	return s.aggregate(ctx, "AVG", column, dest)
+}
+
+// CountDistinct column 不同值的个数，NULL 不计
+func (s *Scope) CountDistinct(ctx context.Context, column string) (int64, error) {
+	if err := s.condErr(); err != nil {
+		return 0, err
+	}
+	var n int64
+	err := s.m.proxy.Find(s.callCtx(ctx), s.aggregateReq([]string{fmt.Sprintf("COUNT(DISTINCT %s)", s.column(column))}), &n)
+	return n, err
+}
+
+// Pluck 查询单个字段到 dest，dest 为基础类型切片的指针，如 *[]int64、*[]string，排序和分页与 Find 相同
+func (s *Scope) Pluck(ctx context.Context, column string, dest interface{}) error {
+	orders, orderArgs, err := s.orderBy()
+	if err != nil {
+		return err
+	}
+	req := s.aggregateReq([]string{s.column(column)})
+	req.Orders = orders
+	req.OrderArgs = orderArgs
+	req.Limit = s.limit
+	req.Offset = s.offset
+	return s.m.proxy.Find(s.callCtx(ctx), req, dest)
+}
+
+// Scan 按 Select 的字段查询到任意结构体切片或 *[]map[string]interface{}，结果按列名对应到字段，
+// 有 Group 时每组一行，如 Select("user_id", "SUM(amount) AS total").Group("user_id").Scan(ctx, &rows)
+func (s *Scope) Scan(ctx context.Context, dest interface{}) error {
+	return s.Find(ctx, dest)
+}
+
+// groupAggregate 每组一行，列为 Group 的字段加上 value
+func (s *Scope) groupAggregate(ctx context.Context, expr string, dest interface{}) error {
+	if len(s.groups) == 0 {
+		return fmt.Errorf("group aggregate on %s requires Group", s.GetTableName())
+	}
+	orders, orderArgs, err := s.orderBy("value")
+	if err != nil {
+		return err
+	}
+	req := s.aggregateReq(append(s.qualifyList(s.groups), fmt.Sprintf("%s AS `value`", expr)))
+	req.needGroup = true
+	req.Groups = []string{s.getGroup()}
+	req.Having = []Expr{s.having.ToExpr()}
+	req.Orders = orders
+	req.OrderArgs = orderArgs
+	req.Limit = s.limit
+	req.Offset = s.offset
+	return s.m.proxy.Find(s.callCtx(ctx), req, dest)
+}
+
+// GroupSum 按 Group 的字段分组求和，dest 为结构体切片或 *[]map[string]interface{}，
+// 每行包含分组字段和 value 列，可以按 value 排序，如 Group("user_id").OrderDesc("value").GroupSum(ctx, "amount", &rows)
+func (s *Scope) GroupSum(ctx context.Context, column string, dest interface{}) error {
+	return s.groupAggregate(ctx, fmt.Sprintf("SUM(%s)", s.column(column)), dest)
+}
+
+// GroupMax 分组的最大值，见 GroupSum
+func (s *Scope) GroupMax(ctx context.Context, column string, dest interface{}) error {
+	return s.groupAggregate(ctx, fmt.Sprintf("MAX(%s)", s.column(column)), dest)
+}
+
+// GroupMin 分组的最小值，见 GroupSum
+func (s *Scope) GroupMin(ctx context.Context, column string, dest interface{}) error {
+	return s.groupAggregate(ctx, fmt.Sprintf("MIN(%s)", s.column(column)), dest)
+}
+
+// GroupAvg 分组的平均值，见 GroupSum
+func (s *Scope) GroupAvg(ctx context.Context, column string, dest interface{}) error {
+	return s.groupAggregate(ctx, fmt.Sprintf("AVG(%s)", s.column(column)), dest)
+}
+
+// GroupCount 每组的行数，见 GroupSum
+func (s *Scope) GroupCount(ctx context.Context, dest interface{}) error {
+	return s.groupAggregate(ctx, "COUNT(*)", dest)
+}
+
+// GroupCountDistinct 每组中 column 不同值的个数，见 GroupSum
+func (s *Scope) GroupCountDistinct(ctx context.Context, column string, dest interface{}) error {
+	return s.groupAggregate(ctx, fmt.Sprintf("COUNT(DISTINCT %s)", s.column(column)), dest)
+}
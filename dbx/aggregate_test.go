@@ -0,0 +1,142 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+type ModelAggItem struct {
+	Id        int32  `json:"id"`
+	UserId    int32  `json:"user_id"`
+	Kind      string `json:"kind"`
+	Amount    int32  `json:"amount"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestAggregate(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelAggItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelAggItem{}}, orm)
+	list := []*ModelAggItem{
+		{UserId: 1, Kind: "a", Amount: 10},
+		{UserId: 1, Kind: "b", Amount: 20},
+		{UserId: 2, Kind: "a", Amount: 30},
+		{UserId: 3, Kind: "a", Amount: 100, DeletedAt: 1},
+	}
+	if _, err := item.NewScope().CreateInBatches(ctx, list, 0); err != nil {
+		t.Fatal(err)
+	}
+	check := func(name string, got, want interface{}, err error) {
+		t.Helper()
+		if err != nil || got != want {
+			t.Errorf("%s: got %v %v, want %v", name, got, err, want)
+		}
+	}
+	var sum int64
+	err := item.NewScope().Sum(ctx, "amount", &sum)
+	check("sum", sum, int64(60), err)
+	var max int32
+	err = item.Where("user_id", 1).Max(ctx, "amount", &max)
+	check("max", max, int32(20), err)
+	var min int64
+	err = item.NewScope().Min(ctx, "amount", &min)
+	check("min", min, int64(10), err)
+	var avg float64
+	err = item.NewScope().Avg(ctx, "amount", &avg)
+	check("avg", avg, float64(20), err)
+	// 超过 float64 精度的整数
+	var big int64
+	err = item.NewScope().Max(ctx, "id + 9007199254740992", &big)
+	check("big max", big, int64(9007199254740995), err)
+	var kind string
+	err = item.NewScope().Max(ctx, "kind", &kind)
+	check("string max", kind, "b", err)
+	empty := int64(1)
+	err = item.Where("user_id", 9).Sum(ctx, "amount", &empty)
+	check("empty sum", empty, int64(0), err)
+	var null sql.NullInt64
+	err = item.Where("user_id", 9).Max(ctx, "amount", &null)
+	check("empty max", null.Valid, false, err)
+	n, err := item.NewScope().CountDistinct(ctx, "user_id")
+	check("count distinct", n, int64(2), err)
+	total, err := item.NewScope().Count(ctx)
+	check("count", total, int64(3), err)
+
+	var ids []int32
+	if err = item.NewScope().OrderDesc("amount").Pluck(ctx, "id", &ids); err != nil || len(ids) != 3 || ids[0] != 3 {
+		t.Errorf("unexpected pluck %v %v", ids, err)
+	}
+
+	var groups []struct {
+		UserId int32
+		Value  float64
+	}
+	if err = item.NewScope().Group("user_id").OrderAsc("user_id").GroupSum(ctx, "amount", &groups); err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].Value != 30 || groups[1].UserId != 2 || groups[1].Value != 30 {
+		t.Errorf("unexpected groups %+v", groups)
+	}
+	var rows []map[string]interface{}
+	if err = item.Select("kind", "COUNT(*) AS cnt").Group("kind").OrderAsc("kind").Scan(ctx, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["kind"] != "a" || rows[1]["kind"] != "b" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+	if err = item.NewScope().GroupCount(ctx, &rows); err == nil {
+		t.Errorf("expected error without Group")
+	}
+}
+
+func TestHaving(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelHavingItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelHavingItem{}}, orm)
+	list := []*ModelHavingItem{
+		{UserId: 1, Amount: 10},
+		{UserId: 1, Amount: 20},
+		{UserId: 2, Amount: 30},
+		{UserId: 3, Amount: 5},
+		{UserId: 4, Amount: 50, DeletedAt: 1},
+	}
+	if _, err := item.NewScope().CreateInBatches(ctx, list, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := item.NewScope().Group("user_id").Count(ctx)
+	if err != nil || n != 3 {
+		t.Errorf("unexpected group count %d %v", n, err)
+	}
+	n, err = item.NewScope().Group("user_id").Having("COUNT(*) > ?", 1).Count(ctx)
+	if err != nil || n != 1 {
+		t.Errorf("unexpected having count %d %v", n, err)
+	}
+	var rows []struct {
+		UserId int32
+		Total  int64
+	}
+	s := item.Select("user_id", "SUM(amount) AS total").Group("user_id").Having("total >=", 10).OrderAsc("user_id")
+	page, err := s.FindPaginate(ctx, &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(rows) != 2 || rows[0].Total != 30 || rows[1].UserId != 2 {
+		t.Errorf("unexpected page %+v %+v", page, rows)
+	}
+	n, err = item.Select("user_id", "SUM(amount) AS total").Group("user_id").Having("total >=", 10).Count(ctx)
+	if err != nil || n != 2 {
+		t.Errorf("unexpected having alias count %d %v", n, err)
+	}
+}
+
+type ModelHavingItem struct {
+	Id        int32 `json:"id"`
+	UserId    int32 `json:"user_id"`
+	Amount    int32 `json:"amount"`
+	DeletedAt int32 `json:"deleted_at"`
+}
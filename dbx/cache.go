@@ -0,0 +1,142 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/cylScripter/chest/log"
+	redisgroup "github.com/cylScripter/chest/redis"
+)
+
+// DefaultCacheExpire DbConfig.CacheExpire 未设置时查询缓存的过期时间
+const DefaultCacheExpire = 5 * time.Minute
+
+// QueryCache 查询缓存用到的 redis 操作，*redisgroup.RedisGroup 实现了它
+type QueryCache interface {
+	GetJson(key string, j interface{}) error
+	SetJson(key string, j interface{}, exp time.Duration) error
+	GetInt64Def(key string, def int64) (int64, error)
+	IncrBy(key string, incr int64) (int64, error)
+}
+
+var _ QueryCache = (*redisgroup.RedisGroup)(nil)
+
+// 缓存 key 带上表的版本号，写表时版本号加 1，旧版本的 key 不会再被读到，等过期即可
+func (p *Db) cacheVersionKey(table string) string {
+	return fmt.Sprintf("dbx:cache:ver:%s:%s", p.config.DbName, table)
+}
+
+// cacheKey 返回查询结果的缓存 key，表名由 req.TableName 或 model 得出，没开缓存、没配 redis 或在事务中时返回空串
+func (p *Db) cacheKey(ctx context.Context, method string, req *WhereReq, model, dest interface{}) string {
+	if !req.EnableCache || p.config.Cache == nil || p.InTransaction(ctx) {
+		return ""
+	}
+	table := p.tableName(req.TableName, model)
+	ver, err := p.config.Cache.GetInt64Def(p.cacheVersionKey(table), 0)
+	if err != nil {
+		log.Warnf("get cache version failed, table %s, err:%v", table, err)
+		return ""
+	}
+	sum := sha1.Sum(cacheQuery(method, dest, req))
+	return fmt.Sprintf("dbx:cache:%s:%s:%d:%s", p.config.DbName, table, ver, hex.EncodeToString(sum[:]))
+}
+
+// cacheQuery 逐个字段写出查询的内容，参数的指针解引用后按类型和 JSON 值写入，
+// 不用 %v，避免指针打印成地址、自定义 String() 的值相互冲突
+func cacheQuery(method string, dest interface{}, req *WhereReq) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s|%T|%q|%q|%d|%d|%v|%v|%v|%d|%q|%d|", method, dest, req.TableName, req.Alias,
+		req.Limit, req.Offset, req.Unscoped, req.OnlyTrashed, req.needGroup,
+		req.SoftDelete.Mode, req.SoftDelete.Column, req.CountStrategy)
+	fmt.Fprintf(&b, "select%q|group%q|order%q|", req.Selects, req.Groups, req.Orders)
+	writeCacheArgs(&b, req.OrderArgs)
+	for _, list := range [][]Expr{req.Cond, req.Joins, req.Having} {
+		for _, e := range list {
+			fmt.Fprintf(&b, "%q", e.Sql)
+			writeCacheArgs(&b, e.Args)
+		}
+		b.WriteString("|")
+	}
+	if req.Lock != nil {
+		fmt.Fprintf(&b, "lock %q %q", req.Lock.Strength, req.Lock.Options)
+	}
+	return b.Bytes()
+}
+
+func writeCacheArgs(b *bytes.Buffer, args []interface{}) {
+	b.WriteString("(")
+	for _, v := range args {
+		if valuer, ok := v.(driver.Valuer); ok {
+			if dv, err := valuer.Value(); err == nil {
+				v = dv
+			}
+		}
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if rv.IsValid() && rv.CanInterface() {
+			v = rv.Interface()
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			data = []byte(fmt.Sprintf("%#v", v))
+		}
+		fmt.Fprintf(b, "%T:%s,", v, data)
+	}
+	b.WriteString(")")
+}
+
+// withCache 命中缓存时直接把结果写到 dest，否则用 req 执行 fn 并回填缓存，redis 出错时退化为直接查库。
+// model 用来确定版本号所在的表，Find/First 的 dest 就是 model。
+// 回填的查询走主库：写表后版本号已经变了，从库有延迟时会把旧数据缓存在新版本下直到过期
+func (p *Db) withCache(ctx context.Context, method string, req *WhereReq, model, dest interface{}, fn func(req *WhereReq) error) error {
+	key := p.cacheKey(ctx, method, req, model, dest)
+	if key == "" {
+		return fn(req)
+	}
+	if err := p.config.Cache.GetJson(key, dest); err == nil {
+		return nil
+	}
+	master := *req
+	master.UseMaster = true
+	if err := fn(&master); err != nil {
+		return err
+	}
+	expire := p.config.CacheExpire
+	if expire <= 0 {
+		expire = DefaultCacheExpire
+	}
+	if err := p.config.Cache.SetJson(key, dest, expire); err != nil {
+		log.Warnf("set cache failed, key %s, err:%v", key, err)
+	}
+	return nil
+}
+
+// invalidateCache 写表后让表上的查询缓存失效，事务中推迟到事务提交后
+func (p *Db) invalidateCache(ctx context.Context, table string) {
+	if p.config.Cache == nil {
+		return
+	}
+	if h := p.txHandle(ctx); h != nil {
+		h.dirty[dirtyTable{db: p, table: table}] = struct{}{}
+		return
+	}
+	p.bumpCacheVersion(table)
+}
+
+func (p *Db) bumpCacheVersion(table string) {
+	if p.config.Cache == nil {
+		return
+	}
+	if _, err := p.config.Cache.IncrBy(p.cacheVersionKey(table), 1); err != nil {
+		log.Errorf("bump cache version failed, table %s, err:%v", table, err)
+	}
+}
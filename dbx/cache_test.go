@@ -0,0 +1,269 @@
+package dbx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCache 内存中的 QueryCache
+type fakeCache struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ints map[string]int64
+	gets int
+	hits int
+	sets int
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{data: map[string][]byte{}, ints: map[string]int64{}}
+}
+
+func (c *fakeCache) GetJson(key string, j interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gets++
+	data, ok := c.data[key]
+	if !ok {
+		return errors.New("not found")
+	}
+	c.hits++
+	return json.Unmarshal(data, j)
+}
+
+func (c *fakeCache) SetJson(key string, j interface{}, exp time.Duration) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sets++
+	c.data[key] = data
+	return nil
+}
+
+func (c *fakeCache) GetInt64Def(key string, def int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.ints[key]; ok {
+		return v, nil
+	}
+	return def, nil
+}
+
+func (c *fakeCache) IncrBy(key string, incr int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ints[key] += incr
+	return c.ints[key], nil
+}
+
+func (c *fakeCache) stats() (gets, hits, sets int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gets, c.hits, c.sets
+}
+
+// newCacheDb 与测试库相同的连接配置，查询缓存用 cache
+func newCacheDb(t *testing.T, cache QueryCache) *Db {
+	cfg := orm.config
+	cfg.Cache = cache
+	db, err := NewDb(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type ModelCacheItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestQueryCache(t *testing.T) {
+	ctx := context.Background()
+	cache := newFakeCache()
+	db := newCacheDb(t, cache)
+	if err := db.AutoMigrate(&ModelCacheItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelCacheItem{}}, db)
+	if err := item.Create(ctx, &ModelCacheItem{Id: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	find := func(ctx context.Context, s *Scope) []*ModelCacheItem {
+		var list []*ModelCacheItem
+		if err := s.EnableCache().OrderAsc("id").Find(ctx, &list); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+
+	if got := find(ctx, item.NewScope()); len(got) != 1 {
+		t.Fatalf("unexpected rows %v", got)
+	}
+	// 绕过 dbx 直接写表，缓存不失效，命中时还是旧结果
+	if err := db.db.Exec("INSERT INTO dbx_cache_item (id, name, deleted_at) VALUES (2, 'b', 0)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := find(ctx, item.NewScope()); len(got) != 1 {
+		t.Errorf("expected cached result, got %d rows", len(got))
+	}
+	if _, hits, _ := cache.stats(); hits != 1 {
+		t.Errorf("expected 1 hit, got %d", hits)
+	}
+
+	// 值相同的不同指针参数命中同一个 key
+	id1, id2 := int32(1), int32(1)
+	find(ctx, item.Where("id", &id1))
+	find(ctx, item.Where("id", &id2))
+	if _, hits, sets := cache.stats(); hits != 2 || sets != 2 {
+		t.Errorf("expected pointer args to share a key, hits %d sets %d", hits, sets)
+	}
+
+	// 写表后版本号变化，旧的缓存不再命中
+	if err := item.Create(ctx, &ModelCacheItem{Id: 3, Name: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := find(ctx, item.NewScope()); len(got) != 3 {
+		t.Errorf("expected fresh result after write, got %d rows", len(got))
+	}
+
+	// 事务中不读也不写缓存
+	gets, _, sets := cache.stats()
+	err := item.Transaction(ctx, func(ctx context.Context) error {
+		if got := find(ctx, item.NewScope()); len(got) != 3 {
+			t.Errorf("unexpected rows in transaction %d", len(got))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, _, s := cache.stats(); g != gets || s != sets {
+		t.Errorf("expected cache skipped in transaction, gets %d->%d sets %d->%d", gets, g, sets, s)
+	}
+}
+
+type ModelCacheTxItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestTransactionCache(t *testing.T) {
+	ctx := context.Background()
+	cache := newFakeCache()
+	db := newCacheDb(t, cache)
+	if err := db.AutoMigrate(&ModelCacheTxItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelCacheTxItem{}}, db)
+	version := func() int64 {
+		v, _ := cache.GetInt64Def(db.cacheVersionKey("dbx_cache_tx_item"), 0)
+		return v
+	}
+
+	// 最外层提交后才让缓存失效，嵌套事务只加一次
+	err := db.Transaction(ctx, func(ctx context.Context) error {
+		if err := item.Create(ctx, &ModelCacheTxItem{Name: "outer"}); err != nil {
+			return err
+		}
+		err := db.Transaction(ctx, func(ctx context.Context) error {
+			return item.Create(ctx, &ModelCacheTxItem{Name: "inner"})
+		})
+		if err != nil {
+			return err
+		}
+		if v := version(); v != 0 {
+			t.Errorf("expected cache version bumped after commit, got %d inside transaction", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := version(); v != 1 {
+		t.Errorf("expected one cache bump for the outermost commit, got %d", v)
+	}
+
+	// 回滚时缓存不失效
+	fail := errors.New("fail")
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		if err := item.Create(ctx, &ModelCacheTxItem{Name: "rollback"}); err != nil {
+			return err
+		}
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Errorf("expected fail, got %v", err)
+	}
+	if v := version(); v != 1 {
+		t.Errorf("expected cache version unchanged after rollback, got %d", v)
+	}
+}
+
+func TestQueryCacheSkipsJoinsAndSubQueries(t *testing.T) {
+	ctx := context.Background()
+	cache := newFakeCache()
+	db := newCacheDb(t, cache)
+	if err := db.AutoMigrate(&ModelCacheItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelCacheItem{}}, db)
+	// 其他表的写入不会让缓存失效，这样的查询不缓存
+	scopes := []*Scope{
+		item.NewScope().Join("dbx_cache_item c2", "c2.id = dbx_cache_item.id"),
+		item.NewScope().Where("id", "IN", item.NewScope()),
+		item.NewScope().WhereExists(item.NewScope().As("c2").Where("$raw", "c2.id = dbx_cache_item.id")),
+	}
+	for i, s := range scopes {
+		var list []*ModelCacheItem
+		if err := s.EnableCache().Find(ctx, &list); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if n, err := s.Count(ctx); err != nil || n != int64(len(list)) {
+			t.Fatalf("%d: unexpected count %d %v", i, n, err)
+		}
+	}
+	if gets, _, sets := cache.stats(); gets != 0 || sets != 0 {
+		t.Errorf("expected cache skipped, gets %d sets %d", gets, sets)
+	}
+}
+
+type ModelCacheCountItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestCountCacheVersion(t *testing.T) {
+	ctx := context.Background()
+	db := newCacheDb(t, newFakeCache())
+	if err := db.AutoMigrate(&ModelCacheCountItem{}); err != nil {
+		t.Fatal(err)
+	}
+	// 不带 TableName 时按 dest 得出表名，写表后计数的缓存失效
+	count := func() int64 {
+		n, err := db.Count(ctx, &WhereReq{EnableCache: true}, &ModelCacheCountItem{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("unexpected count %d", n)
+	}
+	if err := db.Create(ctx, &CreateReq{}, &ModelCacheCountItem{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("expected count cache invalidated, got %d", n)
+	}
+}
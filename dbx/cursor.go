@@ -0,0 +1,297 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm/schema"
+)
+
+// DefaultCursorLimit FindByCursor 未设置 limit 时每页的条数
+const DefaultCursorLimit = 20
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var cursorSecret atomic.Pointer[[]byte]
+
+// SetCursorSecret 设置游标签名的密钥，多实例部署时各实例需要设置相同的密钥，
+// 未设置时使用进程内第一次用到时生成的随机密钥，游标只在本进程内有效
+func SetCursorSecret(secret []byte) {
+	b := append([]byte{}, secret...)
+	cursorSecret.Store(&b)
+}
+
+func getCursorSecret() []byte {
+	if p := cursorSecret.Load(); p != nil {
+		return *p
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	// 并发生成时只用第一个存进去的
+	cursorSecret.CompareAndSwap(nil, &b)
+	return *cursorSecret.Load()
+}
+
+// CursorPaginate 游标分页结果，游标为空表示这个方向上没有更多数据
+type CursorPaginate struct {
+	Limit      int32  `json:"limit"`
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+}
+
+type cursorPayload struct {
+	// Query 排序列和方向的摘要，防止游标用在别的查询上
+	Query  string            `json:"q"`
+	Prev   bool              `json:"p,omitempty"`
+	Values []json.RawMessage `json:"v"`
+}
+
+func encodeCursor(c *cursorPayload) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + signCursor(payload), nil
+}
+
+func decodeCursor(cursor string) (*cursorPayload, error) {
+	payload, sign, ok := strings.Cut(cursor, ".")
+	if !ok || !hmac.Equal([]byte(sign), []byte(signCursor(payload))) {
+		return nil, ErrInvalidCursor
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursorPayload
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func signCursor(payload string) string {
+	mac := hmac.New(sha256.New, getCursorSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// cursorColumns 游标用的排序列和各列是否降序，末尾补上 id 保证顺序唯一，id 的方向与最后一列相同。
+// 只支持模型的字段，不支持表达式、OrderByField 和 NullsFirst/NullsLast
+func (s *Scope) cursorColumns() ([]string, []bool, error) {
+	if err := s.condErr(); err != nil {
+		return nil, nil, err
+	}
+	terms, err := s.orderFields()
+	if err != nil {
+		return nil, nil, err
+	}
+	var cols []string
+	var descs []bool
+	hasId := false
+	for _, t := range terms {
+		if t.expr != "" || len(t.args) > 0 || t.nulls != nullsDefault || t.selectAlias || isExprField(t.field) || strings.IndexByte(t.field, '.') >= 0 {
+			return nil, nil, fmt.Errorf("%w: cursor pagination requires plain column orders", ErrInvalidOrder)
+		}
+		if t.field == "id" {
+			hasId = true
+		}
+		cols = append(cols, t.field)
+		descs = append(descs, t.desc)
+	}
+	if !hasId {
+		cols = append(cols, "id")
+		descs = append(descs, len(descs) > 0 && descs[len(descs)-1])
+	}
+	return cols, descs, nil
+}
+
+// keysetCond 生成 (c1 > v1) OR (c1 = v1 AND c2 > v2) ... 形式的条件，desc[i] 为 true 的列用 <
+func keysetCond(cols []string, values []interface{}, desc []bool) (string, []interface{}) {
+	var ors []string
+	var args []interface{}
+	for i := range cols {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, fmt.Sprintf("%s = ?", quoteFieldName(cols[j])))
+			args = append(args, values[j])
+		}
+		op := ">"
+		if desc[i] {
+			op = "<"
+		}
+		ands = append(ands, fmt.Sprintf("%s %s ?", quoteFieldName(cols[i]), op))
+		args = append(args, values[i])
+		ors = append(ors, fmt.Sprintf("(%s)", strings.Join(ands, " AND ")))
+	}
+	return strings.Join(ors, " OR "), args
+}
+
+// FindByCursor 按排序列做 keyset 分页，dest 为结构体切片的指针。
+// cursor 为空时查第一页，否则传上次返回的 NextCursor 或 PrevCursor；排序列由 OrderAsc/OrderDesc/SortBy 指定，各列方向可以不同，末尾自动补上 id，
+// 每页条数由 SetLimit 指定，默认 DefaultCursorLimit。游标带签名，被篡改或用在排序、条件不同的查询上时返回 ErrInvalidCursor
+func (s *Scope) FindByCursor(ctx context.Context, cursor string, dest interface{}) (*CursorPaginate, error) {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("dest required pointer to slice, but got %T", dest)
+	}
+	sch, err := parseSchema(dest)
+	if err != nil {
+		return nil, err
+	}
+	cols, descs, err := s.cursorColumns()
+	if err != nil {
+		return nil, err
+	}
+	var fields []*schema.Field
+	for _, c := range cols {
+		f := sch.LookUpField(c)
+		if f == nil {
+			return nil, fmt.Errorf("order column %s not found in %T", c, dest)
+		}
+		fields = append(fields, f)
+	}
+	limit := s.limit
+	if limit == 0 {
+		limit = DefaultCursorLimit
+	} else if limit > DefaultLimit {
+		limit = DefaultLimit
+	}
+	// 游标只能用在表、排序、条件、Join 和软删除范围都相同的查询上
+	filter := s.condExpr()
+	var query bytes.Buffer
+	fmt.Fprintf(&query, "%s|%s|%v|%v|%v|%s|", s.GetTableName(), strings.Join(cols, ","), descs, s.unscoped, s.onlyTrashed, filter.Sql)
+	writeCacheArgs(&query, filter.Args)
+	for _, j := range s.joins {
+		fmt.Fprintf(&query, "%q", j.Sql)
+		writeCacheArgs(&query, j.Args)
+	}
+	sum := sha256.Sum256(query.Bytes())
+	queryHash := base64.RawURLEncoding.EncodeToString(sum[:8])
+
+	prev := false
+	var values []interface{}
+	if cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Query != queryHash || len(c.Values) != len(fields) {
+			return nil, ErrInvalidCursor
+		}
+		values = make([]interface{}, len(fields))
+		for i, f := range fields {
+			v := reflect.New(f.FieldType)
+			if err = json.Unmarshal(c.Values[i], v.Interface()); err != nil {
+				return nil, ErrInvalidCursor
+			}
+			values[i] = v.Elem().Interface()
+		}
+		prev = c.Prev
+	}
+	// 向前翻页时反向查询，查完再把结果倒过来
+	dirs := make([]bool, len(descs))
+	for i, d := range descs {
+		dirs[i] = d != prev
+	}
+	alias := s.qualifier()
+	// 原有条件整体加上括号再与 keyset 条件 AND，OrWhere 的条件不会把 keyset 条件或掉
+	where := filter
+	if values != nil {
+		sql, args := keysetCond(cols, values, dirs)
+		if alias != "" {
+			sql = qualifyIdentifiers(sql, alias)
+		}
+		if where.Sql != "" {
+			sql = fmt.Sprintf("(%s) AND (%s)", where.Sql, sql)
+			args = append(append([]interface{}{}, where.Args...), args...)
+		}
+		where = Expr{Sql: sql, Args: args}
+	}
+	var orders []string
+	for i, c := range cols {
+		col := quoteFieldName(c)
+		if alias != "" {
+			col = qualifyColumn(c, alias)
+		}
+		dir := "ASC"
+		if dirs[i] {
+			dir = "DESC"
+		}
+		orders = append(orders, fmt.Sprintf("%s %s", col, dir))
+	}
+	// 多查一条判断后面是否还有数据
+	err = s.m.proxy.Find(s.callCtx(ctx), &WhereReq{
+		Unscoped:    s.unscoped,
+		OnlyTrashed: s.onlyTrashed,
+		SoftDelete:  s.m.SoftDelete,
+		Cond:        []Expr{where},
+		Alias:       alias,
+		Joins:       s.joins,
+		Limit:       limit + 1,
+		Orders:      orders,
+		Selects:     s.selectColumns(),
+		TableName:   s.GetTableName(),
+		Db:          s.db,
+		UseMaster:   s.useMaster,
+	}, dest)
+	if err != nil {
+		return nil, err
+	}
+	list := dv.Elem()
+	hasMore := list.Len() > int(limit)
+	if hasMore {
+		list.SetLen(int(limit))
+	}
+	if prev {
+		swap := reflect.Swapper(list.Interface())
+		for i, j := 0, list.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	// 多查的那一条不返回，也不调用钩子
+	if err = callAfterFind(ctx, dest); err != nil {
+		return nil, err
+	}
+	res := &CursorPaginate{Limit: int32(limit)}
+	if list.Len() == 0 {
+		return res, nil
+	}
+	rowCursor := func(row reflect.Value, prev bool) (string, error) {
+		c := &cursorPayload{Query: queryHash, Prev: prev}
+		for _, f := range fields {
+			v, _ := f.ValueOf(ctx, reflect.Indirect(row))
+			b, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			c.Values = append(c.Values, b)
+		}
+		return encodeCursor(c)
+	}
+	// 正向翻页时有多余的一条说明后面还有，反向翻页回来的那一页后面一定还有
+	if (!prev && hasMore) || (prev && cursor != "") {
+		if res.NextCursor, err = rowCursor(list.Index(list.Len()-1), false); err != nil {
+			return nil, err
+		}
+	}
+	if (prev && hasMore) || (!prev && cursor != "") {
+		if res.PrevCursor, err = rowCursor(list.Index(0), true); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
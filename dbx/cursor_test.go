@@ -0,0 +1,168 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type ModelCursorItem struct {
+	Id        int32  `json:"id"`
+	Score     int32  `json:"score"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestFindByCursor(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelCursorItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelCursorItem{}}, orm)
+	for i, score := range []int32{5, 3, 5, 1, 4, 5, 2} {
+		if err := item.Create(ctx, &ModelCursorItem{Id: int32(i + 1), Score: score}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(list []*ModelCursorItem) []int32 {
+		var res []int32
+		for _, v := range list {
+			res = append(res, v.Id)
+		}
+		return res
+	}
+	page := func(cursor string) ([]int32, *CursorPaginate) {
+		var list []*ModelCursorItem
+		res, err := item.NewScope().OrderDesc("score").SetLimit(3).FindByCursor(ctx, cursor, &list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids(list), res
+	}
+	// score desc, id desc: 6(5) 3(5) 1(5) 5(4) 2(3) 7(2) 4(1)
+	p1, r1 := page("")
+	p2, r2 := page(r1.NextCursor)
+	p3, r3 := page(r2.NextCursor)
+	back, _ := page(r3.PrevCursor)
+	if got := [][]int32{p1, p2, p3, back}; !equalIds(got, [][]int32{{6, 3, 1}, {5, 2, 7}, {4}, {5, 2, 7}}) {
+		t.Errorf("unexpected pages %v", got)
+	}
+	if r1.PrevCursor != "" || r3.NextCursor != "" {
+		t.Errorf("unexpected cursors on first/last page")
+	}
+
+	var list []*ModelCursorItem
+	if _, err := item.NewScope().OrderAsc("score").FindByCursor(ctx, r1.NextCursor, &list); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for another order, got %v", err)
+	}
+	if _, err := item.NewScope().OrderDesc("score").FindByCursor(ctx, "x"+r1.NextCursor, &list); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for tampered cursor, got %v", err)
+	}
+	// 条件不同的查询不能用同一个游标
+	filtered := func(min int32) *Scope {
+		return item.Where("score", ">=", min).OrderDesc("score").SetLimit(2)
+	}
+	r, err := filtered(2).FindByCursor(ctx, "", &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = filtered(2).FindByCursor(ctx, r.NextCursor, &list); err != nil {
+		t.Errorf("unexpected error for same filter %v", err)
+	}
+	if _, err = filtered(3).FindByCursor(ctx, r.NextCursor, &list); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for another filter, got %v", err)
+	}
+	// 软删除范围不同的查询也不能用
+	if _, err = filtered(2).Unscoped().FindByCursor(ctx, r.NextCursor, &list); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for unscoped query, got %v", err)
+	}
+
+	// Model.OrWhere 的 OR 条件整体与 keyset 条件 AND
+	orPage := func(cursor string) ([]int32, *CursorPaginate) {
+		var list []*ModelCursorItem
+		res, err := item.OrWhere("score", 5).OrWhere("score", 1).OrderDesc("score").SetLimit(2).FindByCursor(ctx, cursor, &list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids(list), res
+	}
+	o1, or1 := orPage("")
+	o2, or2 := orPage(or1.NextCursor)
+	if got := [][]int32{o1, o2}; !equalIds(got, [][]int32{{6, 3}, {1, 4}}) || or2.NextCursor != "" {
+		t.Errorf("unexpected pages with OrWhere %v", got)
+	}
+}
+
+type ModelCursorHookItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+var cursorHookCalls []int32
+
+func (m *ModelCursorHookItem) AfterFind(ctx context.Context) error {
+	cursorHookCalls = append(cursorHookCalls, m.Id)
+	return nil
+}
+
+func TestFindByCursorAfterFind(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelCursorHookItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelCursorHookItem{}}, orm)
+	for i := int32(1); i <= 5; i++ {
+		if err := item.Create(ctx, &ModelCursorHookItem{Id: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page := func(cursor string) *CursorPaginate {
+		cursorHookCalls = nil
+		var list []*ModelCursorHookItem
+		res, err := item.NewScope().OrderAsc("id").SetLimit(2).FindByCursor(ctx, cursor, &list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	// 多查的一条不调用钩子，反向翻页时按倒回来的顺序调用
+	r1 := page("")
+	if !equalIds([][]int32{cursorHookCalls}, [][]int32{{1, 2}}) {
+		t.Errorf("unexpected hook calls %v", cursorHookCalls)
+	}
+	r2 := page(r1.NextCursor)
+	page(r2.PrevCursor)
+	if !equalIds([][]int32{cursorHookCalls}, [][]int32{{1, 2}}) {
+		t.Errorf("unexpected hook calls on prev page %v", cursorHookCalls)
+	}
+}
+
+func TestCursorSecret(t *testing.T) {
+	payload := "x"
+	sign := signCursor(payload)
+	if signCursor(payload) != sign {
+		t.Fatalf("expected stable default secret")
+	}
+	SetCursorSecret([]byte("secret"))
+	if signCursor(payload) == sign {
+		t.Errorf("expected signature changed with secret")
+	}
+}
+
+func equalIds(a, b [][]int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
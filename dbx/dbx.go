@@ -3,98 +3,56 @@ package dbx
 import (
 	"fmt"
 	"github.com/cylScripter/chest/log"
-	"github.com/cylScripter/chest/utils"
 	"reflect"
-	"strconv"
+	"sort"
 	"strings"
 
 	"github.com/elliotchance/pie/pie"
 )
 
+// Expr 带 ? 占位符的 sql 片段及其参数，参数由驱动以 prepared statement 的方式传递
+type Expr struct {
+	Sql  string
+	Args []interface{}
+}
+
 type Cond struct {
 	conds       pie.Strings
+	args        []interface{}
 	isOr        bool
 	isTopLevel  bool
 	tablePrefix string
+	// err 构造条件时的错误（如子查询无效），在执行查询时返回
+	err error
+	// subs 条件中的子查询，执行时检查它们与外层查询在同一个连接上
+	subs []*Scope
 }
 
+// quoteFieldName 用反引号引用字段名，table.field 分别引用
 func quoteFieldName(name string) string {
-	if !strings.HasPrefix(name, "`") {
-		name = fmt.Sprintf("`%s`", name)
-	}
-	return name
-}
-func quoteStr(s string) string {
-	return fmt.Sprintf("'%s'", s)
-}
-
-func simpleTypeToStr(value interface{}, quoteSlice bool) string {
-	if value == nil {
-		panic("value nil")
-	}
-	vo := reflect.ValueOf(value)
-	for vo.Kind() == reflect.Ptr || vo.Kind() == reflect.Interface {
-		vo = vo.Elem()
-	}
-	value = vo.Interface()
-	switch v := value.(type) {
-	case string:
-		v = utils.EscapeMysqlString(v)
-		return quoteStr(v)
-	case []byte:
-		s := utils.EscapeMysqlString(string(v))
-		return quoteStr(s)
-	case bool:
-		if v {
-			return "1"
-		} else {
-			return "0"
-		}
+	if strings.HasPrefix(name, "`") {
+		return name
 	}
-	// 容器单独处理
-	switch vo.Kind() {
-	case reflect.Slice, reflect.Array:
-		var elList []string
-		count := vo.Len()
-		for x := 0; x < count; x++ {
-			el := vo.Index(x)
-			elList = append(elList, simpleTypeToStr(el.Interface(), quoteSlice))
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if part != "*" {
+			parts[i] = fmt.Sprintf("`%s`", part)
 		}
-		res := strings.Join(elList, ",")
-		if quoteSlice {
-			res = fmt.Sprintf("(%s)", res)
-		}
-		return res
-	case reflect.Uint32, reflect.Uint64, reflect.Uint16, reflect.Uint8, reflect.Uint:
-		return strconv.FormatUint(vo.Uint(), 10)
-	case reflect.Int32, reflect.Int64, reflect.Int16, reflect.Int8, reflect.Int:
-		return strconv.FormatInt(vo.Int(), 10)
 	}
-	return quoteStr(fmt.Sprintf("%v", value))
+	return strings.Join(parts, ".")
 }
-
 func (p *Cond) whereRaw(cond string, values ...interface{}) {
-	var res string
-	if len(values) == 0 {
-		res = cond
-	} else {
-		list := strings.Split(cond, "?")
-		if len(list)-1 != len(values) {
-			log.Warnf("invalid number of values, q %d, v %d", len(list)-1, len(values))
-		}
-		var out []string
-		for i := 0; i < len(list); i++ {
-			out = append(out, list[i])
-			if i < len(list)-1 && i < len(values) {
-				value := values[i]
-				out = append(out, simpleTypeToStr(value, false))
-			}
-		}
-		res = strings.Join(out, "")
+	if cond == "" {
+		return
 	}
-	if res != "" {
-		p.conds = append(p.conds, fmt.Sprintf("(%s)", res))
+	if len(values) > 0 {
+		if n := strings.Count(cond, "?"); n != len(values) {
+			log.Warnf("invalid number of values, q %d, v %d", n, len(values))
+		}
+		cond, values = p.expandSubQueries(cond, values)
 	}
+	p.conds = append(p.conds, fmt.Sprintf("(%s)", cond))
+	p.args = append(p.args, values...)
 }
 
 func (p *Cond) addCond(fieldName, op string, val interface{}) {
@@ -106,14 +64,42 @@ func (p *Cond) addCond(fieldName, op string, val interface{}) {
 	}
 
 	if p.tablePrefix == "" {
-		p.conds = append(p.conds,
-			fmt.Sprintf("(%s %s %s)",
-				quoteFieldName(fieldName), op, simpleTypeToStr(val, true)))
+		fieldName = quoteFieldName(fieldName)
 	} else {
-		p.conds = append(p.conds,
-			fmt.Sprintf("(%s %s %s)",
-				fmt.Sprintf("%s.%s", p.tablePrefix, fieldName), op, simpleTypeToStr(val, true)))
+		fieldName = fmt.Sprintf("%s.%s", p.tablePrefix, fieldName)
+	}
+	if sub, ok := val.(*Scope); ok {
+		// 子查询作为值，如 IN / NOT IN / =
+		e := p.subExpr(sub)
+		p.conds = append(p.conds, fmt.Sprintf("(%s %s (%s))", fieldName, op, e.Sql))
+		p.args = append(p.args, e.Args...)
+		return
+	}
+	if isNilValue(val) {
+		// = nil / != nil 按 IS NULL / IS NOT NULL 处理
+		switch op {
+		case "=":
+			p.conds = append(p.conds, fmt.Sprintf("(%s IS NULL)", fieldName))
+			return
+		case "!=", "<>":
+			p.conds = append(p.conds, fmt.Sprintf("(%s IS NOT NULL)", fieldName))
+			return
+		}
+	}
+	p.conds = append(p.conds, fmt.Sprintf("(%s %s ?)", fieldName, op))
+	p.args = append(p.args, val)
+}
+
+func isNilValue(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+	vo := reflect.ValueOf(val)
+	switch vo.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map:
+		return vo.IsNil()
 	}
+	return false
 }
 
 func getFirstInvalidFieldNameCharIndex(s string) int {
@@ -122,7 +108,7 @@ func getFirstInvalidFieldNameCharIndex(s string) int {
 		if !((c >= 'a' && c <= 'z') ||
 			(c >= 'A' && c <= 'Z') ||
 			(c >= '0' && c <= '9') ||
-			c == '_') {
+			c == '_' || c == '.') {
 			return i
 		}
 	}
@@ -134,12 +120,14 @@ func (p *Cond) addSubWhere(isOr bool, args ...interface{}) {
 		tablePrefix: p.tablePrefix,
 	}
 	subCond.where(args...)
+	p.inherit(subCond)
 	c := subCond.ToString()
 	if c == "" {
 		return
 	}
 
 	p.conds = append(p.conds, c)
+	p.args = append(p.args, subCond.args...)
 }
 func (p *Cond) addCmdCond(cmd string, cond interface{}) {
 	if strings.HasPrefix(cmd, "or") {
@@ -271,7 +259,12 @@ func (p *Cond) where(args ...interface{}) {
 		if typ.Key().Kind() != reflect.String {
 			panic(fmt.Sprintf("map key type required string, but got %v", typ.Key()))
 		}
-		for _, k := range arg0.MapKeys() {
+		// 按字段名排序，同样的条件生成同样的 sql，查询缓存和游标的 key 才稳定
+		keys := arg0.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		for _, k := range keys {
 			fieldName := k.String()
 			val := arg0.MapIndex(k)
 			if !val.IsValid() || !val.CanInterface() {
@@ -347,6 +340,28 @@ func (p *Cond) ToString() string {
 	}
 	return s
 }
+
+// inherit 带上子条件中记下的错误和子查询
+func (p *Cond) inherit(c *Cond) {
+	if p.err == nil {
+		p.err = c.err
+	}
+	p.subs = append(p.subs, c.subs...)
+}
+
+// Args 按占位符顺序返回 ToString 中 ? 对应的参数
+func (p *Cond) Args() []interface{} {
+	return p.args
+}
+
+// ToExpr 返回条件 sql 及其参数
+func (p *Cond) ToExpr() Expr {
+	return Expr{
+		Sql:  p.ToString(),
+		Args: p.args,
+	}
+}
+
 func (p *Cond) Where(args ...interface{}) *Cond {
 	p.addSubWhere(false, args...)
 	return p
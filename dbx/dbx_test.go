@@ -0,0 +1,65 @@
+package dbx
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCondBindArgs(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cases := []struct {
+		name string
+		args []interface{}
+		sql  string
+		vals []interface{}
+	}{
+		{"eq", []interface{}{"name", "a' or '1'='1"}, "(`name` = ?)", []interface{}{"a' or '1'='1"}},
+		{"op", []interface{}{"age", ">", 18}, "(`age` > ?)", []interface{}{18}},
+		{"op in name", []interface{}{"score>=", 1.5}, "(`score` >= ?)", []interface{}{1.5}},
+		{"time", []interface{}{"created", "<", now}, "(`created` < ?)", []interface{}{now}},
+		{"in", []interface{}{"id", "IN", []int{1, 2}}, "(`id` IN ?)", []interface{}{[]int{1, 2}}},
+		{"raw", []interface{}{"a = ? or b = ?", 1, "x"}, "(a = ? or b = ?)", []interface{}{1, "x"}},
+		{"nil", []interface{}{"deleted", nil}, "(`deleted` IS NULL)", nil},
+		{"bool", []interface{}{false}, "(1=0)", nil},
+	}
+	for _, c := range cases {
+		cond := &Cond{isTopLevel: true}
+		cond.where(c.args...)
+		e := cond.ToExpr()
+		if e.Sql != c.sql {
+			t.Errorf("%s: sql %q, want %q", c.name, e.Sql, c.sql)
+		}
+		if !reflect.DeepEqual(e.Args, c.vals) {
+			t.Errorf("%s: args %v, want %v", c.name, e.Args, c.vals)
+		}
+	}
+}
+
+func TestCondNestedArgs(t *testing.T) {
+	cond := &Cond{isTopLevel: true}
+	cond.Where("a", 1).OrWhere([]interface{}{
+		[]interface{}{"b", 2},
+		[]interface{}{"c", "<", 3},
+	}).Where("$raw", []interface{}{"d = ?", 4})
+	e := cond.ToExpr()
+	want := "(`a` = ?) AND ((`b` = ?) OR (`c` < ?)) AND (d = ?)"
+	if e.Sql != want {
+		t.Errorf("sql %q, want %q", e.Sql, want)
+	}
+	if !reflect.DeepEqual(e.Args, []interface{}{1, 2, 3, 4}) {
+		t.Errorf("args %v", e.Args)
+	}
+}
+
+func TestCondMapOrder(t *testing.T) {
+	want := "((`a` = ?) AND (`b` > ?) AND (`c` = ?))"
+	for i := 0; i < 20; i++ {
+		cond := &Cond{isTopLevel: true}
+		cond.Where(map[string]interface{}{"c": 3, "a": 1, "b >": 2})
+		e := cond.ToExpr()
+		if e.Sql != want || !reflect.DeepEqual(e.Args, []interface{}{1, 2, 3}) {
+			t.Fatalf("sql %q args %v, want %q", e.Sql, e.Args, want)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+// Package dbxtest 提供内存中的 dbx.DbProxy 实现，用于不连数据库的单元测试：
+// 记录收到的每个请求，按表和方法预设返回值或错误，并提供断言
+package dbxtest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cylScripter/chest/dbx"
+	"github.com/cylScripter/openapi/base"
+	"gorm.io/gorm"
+)
+
+// Method* 与 dbx 的 Op* 相同，Call.Method 的取值
+const (
+	MethodFirst        = dbx.OpFirst
+	MethodFind         = dbx.OpFind
+	MethodCreate       = dbx.OpCreate
+	MethodCreateBatch  = dbx.OpCreateInBatches
+	MethodUpsert       = dbx.OpUpsert
+	MethodToSql        = dbx.OpToSql
+	MethodFindPaginate = dbx.OpFindPaginate
+	MethodCount        = dbx.OpCount
+	MethodDelete       = dbx.OpDelete
+	MethodAutoMigrate  = dbx.OpAutoMigrate
+	MethodUpdate       = dbx.OpUpdate
+	MethodSave         = dbx.OpSave
+	MethodTransaction  = dbx.OpTransaction
+	MethodRows         = dbx.OpRows
+)
+
+// Call 一次 DbProxy 调用，Where 和 Create 只有一个非空
+type Call struct {
+	Method string
+	Table  string
+	Where  *dbx.WhereReq
+	Create *dbx.CreateReq
+	Dest   interface{}
+	Values map[string]interface{}
+}
+
+// Cond 用 AND 连接的条件 sql
+func (c *Call) Cond() string {
+	if c.Where == nil {
+		return ""
+	}
+	var list []string
+	for _, e := range c.Where.Cond {
+		if e.Sql != "" {
+			list = append(list, e.Sql)
+		}
+	}
+	return strings.Join(list, " AND ")
+}
+
+// Args 条件参数，顺序与 Cond 中的占位符一致
+func (c *Call) Args() []interface{} {
+	if c.Where == nil {
+		return nil
+	}
+	var args []interface{}
+	for _, e := range c.Where.Cond {
+		args = append(args, e.Args...)
+	}
+	return args
+}
+
+// Stub 预设的返回，通过 Proxy.On 创建
+type Stub struct {
+	result       interface{}
+	err          error
+	count        int64
+	rowsAffected uint64
+	paginate     *base.Paginate
+	upsert       *dbx.UpdateOrCreateResult
+	sql          string
+	fn           func(call *Call) error
+}
+
+// Return First/Find/FindPaginate 写到 dest 的结果，类型需要与 dest 指向的类型一致（或是它的指针）
+func (s *Stub) Return(result interface{}) *Stub {
+	s.result = result
+	return s
+}
+
+func (s *Stub) ReturnErr(err error) *Stub {
+	s.err = err
+	return s
+}
+
+// ReturnCount Count 的返回值
+func (s *Stub) ReturnCount(count int64) *Stub {
+	s.count = count
+	return s
+}
+
+// ReturnRowsAffected Update/Delete 的影响行数，CreateInBatches 实际插入的行数
+func (s *Stub) ReturnRowsAffected(n uint64) *Stub {
+	s.rowsAffected = n
+	return s
+}
+
+// ReturnPaginate FindPaginate 的分页信息，不设置时按结果条数生成
+func (s *Stub) ReturnPaginate(paginate *base.Paginate) *Stub {
+	s.paginate = paginate
+	return s
+}
+
+// ReturnUpsert Upsert 的结果，不设置时为插入了新行
+func (s *Stub) ReturnUpsert(res dbx.UpdateOrCreateResult) *Stub {
+	s.upsert = &res
+	return s
+}
+
+func (s *Stub) ReturnSql(sql string) *Stub {
+	s.sql = sql
+	return s
+}
+
+// Do 调用时执行 fn，fn 可以改写 call.Dest，返回的 error 作为调用结果
+func (s *Stub) Do(fn func(call *Call) error) *Stub {
+	s.fn = fn
+	return s
+}
+
+type stubKey struct {
+	method string
+	table  string
+}
+
+// Proxy 内存中的 dbx.DbProxy，可以并发使用
+type Proxy struct {
+	mu    sync.Mutex
+	calls []*Call
+	stubs map[stubKey]*Stub
+}
+
+var _ dbx.DbProxy = (*Proxy)(nil)
+
+func New() *Proxy {
+	return &Proxy{
+		stubs: map[stubKey]*Stub{},
+	}
+}
+
+// On 预设 table 上 method 的返回，table 为空时匹配所有表，同一个 method/table 重复调用会覆盖
+func (p *Proxy) On(method, table string) *Stub {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := &Stub{}
+	p.stubs[stubKey{method: method, table: table}] = s
+	return s
+}
+
+// Reset 清空调用记录和预设
+func (p *Proxy) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = nil
+	p.stubs = map[stubKey]*Stub{}
+}
+
+// Calls 按顺序返回所有调用
+func (p *Proxy) Calls() []*Call {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Call{}, p.calls...)
+}
+
+// CallsOf 返回 table 上 method 的调用，table 为空时不限表
+func (p *Proxy) CallsOf(method, table string) []*Call {
+	var list []*Call
+	for _, c := range p.Calls() {
+		if c.Method == method && (table == "" || c.Table == table) {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+// AssertCalled 断言 table 上调用过 method，cond 非空时还要求条件 sql 相同，args 非空时要求参数相同
+func (p *Proxy) AssertCalled(t testing.TB, method, table, cond string, args ...interface{}) *Call {
+	t.Helper()
+	calls := p.CallsOf(method, table)
+	for _, c := range calls {
+		if cond != "" && c.Cond() != cond {
+			continue
+		}
+		if len(args) > 0 && !reflect.DeepEqual(c.Args(), args) {
+			continue
+		}
+		return c
+	}
+	var got []string
+	for _, c := range calls {
+		got = append(got, fmt.Sprintf("%s %v", c.Cond(), c.Args()))
+	}
+	t.Errorf("expected %s on table %s with cond %q %v, got %d calls %v", method, table, cond, args, len(calls), got)
+	return nil
+}
+
+// AssertNotCalled 断言 table 上没有调用过 method
+func (p *Proxy) AssertNotCalled(t testing.TB, method, table string) {
+	t.Helper()
+	if calls := p.CallsOf(method, table); len(calls) > 0 {
+		t.Errorf("unexpected %s on table %s, got %d calls", method, table, len(calls))
+	}
+}
+
+func (p *Proxy) record(c *Call) *Stub {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, c)
+	if s, ok := p.stubs[stubKey{method: c.Method, table: c.Table}]; ok {
+		return s
+	}
+	if s, ok := p.stubs[stubKey{method: c.Method}]; ok {
+		return s
+	}
+	return nil
+}
+
+// run 记录调用，按预设写结果，返回预设的 error
+func (p *Proxy) run(c *Call) (*Stub, error) {
+	s := p.record(c)
+	if s == nil {
+		return &Stub{}, nil
+	}
+	if s.result != nil && c.Dest != nil {
+		if err := assign(c.Dest, s.result); err != nil {
+			return s, err
+		}
+	}
+	if s.fn != nil {
+		if err := s.fn(c); err != nil {
+			return s, err
+		}
+	}
+	return s, s.err
+}
+
+func assign(dest, result interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("dest required non-nil pointer, but got %T", dest)
+	}
+	rv := reflect.ValueOf(result)
+	el := dv.Elem()
+	if rv.Type().AssignableTo(el.Type()) {
+		el.Set(rv)
+		return nil
+	}
+	if rv.Kind() == reflect.Ptr && rv.Elem().Type().AssignableTo(el.Type()) {
+		el.Set(rv.Elem())
+		return nil
+	}
+	// dest 为 sql.NullInt64 等（如 Scope.Sum）时按 Scan 的规则转换
+	if sc, ok := dest.(sql.Scanner); ok {
+		return sc.Scan(result)
+	}
+	return fmt.Errorf("result %T can't assign to dest %T", result, dest)
+}
+
+func (p *Proxy) First(ctx context.Context, req *dbx.WhereReq, dest interface{}) error {
+	s, err := p.run(&Call{Method: MethodFirst, Table: req.TableName, Where: req, Dest: dest})
+	if err == nil && s.result == nil && s.fn == nil {
+		// 没有预设结果时与真实库一致，返回记录不存在
+		return gorm.ErrRecordNotFound
+	}
+	return err
+}
+
+func (p *Proxy) Find(ctx context.Context, req *dbx.WhereReq, dest interface{}) error {
+	_, err := p.run(&Call{Method: MethodFind, Table: req.TableName, Where: req, Dest: dest})
+	return err
+}
+
+func (p *Proxy) Create(ctx context.Context, req *dbx.CreateReq, dest interface{}) error {
+	_, err := p.run(&Call{Method: MethodCreate, Table: req.TableName, Create: req, Dest: dest})
+	return err
+}
+
+// CreateInBatches 默认全部插入成功，ReturnRowsAffected 可以指定插入的条数
+func (p *Proxy) CreateInBatches(ctx context.Context, req *dbx.CreateReq, dest interface{}) (dbx.CreateResult, error) {
+	s, err := p.run(&Call{Method: MethodCreateBatch, Table: req.TableName, Create: req, Dest: dest})
+	if err != nil {
+		return dbx.CreateResult{}, err
+	}
+	var n uint64
+	if v := reflect.Indirect(reflect.ValueOf(dest)); v.Kind() == reflect.Slice {
+		n = uint64(v.Len())
+	}
+	res := dbx.CreateResult{Inserted: n}
+	if s.rowsAffected > 0 && s.rowsAffected < n {
+		res.Inserted = s.rowsAffected
+		res.Skipped = n - s.rowsAffected
+	}
+	return res, nil
+}
+
+func (p *Proxy) Upsert(ctx context.Context, req *dbx.CreateReq, dest interface{}) (dbx.UpdateOrCreateResult, error) {
+	s, err := p.run(&Call{Method: MethodUpsert, Table: req.TableName, Create: req, Dest: dest})
+	if err != nil {
+		return dbx.UpdateOrCreateResult{}, err
+	}
+	if s.upsert != nil {
+		return *s.upsert, nil
+	}
+	return dbx.UpdateOrCreateResult{Created: true, RowsAffected: 1}, nil
+}
+
+func (p *Proxy) ToSql(ctx context.Context, req *dbx.WhereReq, dest interface{}) (string, error) {
+	s, err := p.run(&Call{Method: MethodToSql, Table: req.TableName, Where: req, Dest: dest})
+	return s.sql, err
+}
+
+func (p *Proxy) FindPaginate(ctx context.Context, req *dbx.WhereReq, dest interface{}) (*base.Paginate, error) {
+	s, err := p.run(&Call{Method: MethodFindPaginate, Table: req.TableName, Where: req, Dest: dest})
+	if s.paginate != nil {
+		return s.paginate, err
+	}
+	res := &base.Paginate{
+		Offset: int32(req.Offset),
+		Limit:  int32(req.Limit),
+	}
+	if v := reflect.Indirect(reflect.ValueOf(dest)); v.Kind() == reflect.Slice {
+		res.Total = int32(v.Len())
+	}
+	return res, err
+}
+
+func (p *Proxy) Count(ctx context.Context, req *dbx.WhereReq, dest interface{}) (int64, error) {
+	s, err := p.run(&Call{Method: MethodCount, Table: req.TableName, Where: req, Dest: dest})
+	return s.count, err
+}
+
+func (p *Proxy) Delete(ctx context.Context, req *dbx.WhereReq, dest interface{}) (dbx.DeleteResult, error) {
+	s, err := p.run(&Call{Method: MethodDelete, Table: req.TableName, Where: req, Dest: dest})
+	return dbx.DeleteResult{RowsAffected: s.rowsAffected}, err
+}
+
+func (p *Proxy) AutoMigrate(dest ...interface{}) error {
+	_, err := p.run(&Call{Method: MethodAutoMigrate, Dest: dest})
+	return err
+}
+
+func (p *Proxy) Update(ctx context.Context, req *dbx.WhereReq, dest interface{}, values map[string]interface{}) (dbx.UpdateResult, error) {
+	s, err := p.run(&Call{Method: MethodUpdate, Table: req.TableName, Where: req, Dest: dest, Values: values})
+	return dbx.UpdateResult{RowsAffected: s.rowsAffected}, err
+}
+
+func (p *Proxy) Save(ctx context.Context, req *dbx.WhereReq, dest interface{}) error {
+	_, err := p.run(&Call{Method: MethodSave, Table: req.TableName, Where: req, Dest: dest})
+	return err
+}
+
+// Rows 返回预设结果（切片）逐行读取的 Rows，没有预设时没有行
+func (p *Proxy) Rows(ctx context.Context, req *dbx.WhereReq, dest interface{}) (*dbx.Rows, error) {
+	s, err := p.run(&Call{Method: MethodRows, Table: req.TableName, Where: req})
+	if err != nil {
+		return nil, err
+	}
+	if s.result != nil {
+		return dbx.SliceRows(s.result), nil
+	}
+	return dbx.SliceRows(nil), nil
+}
+
+// Transaction 直接执行 fn，没有回滚，fn 中的调用照常记录
+func (p *Proxy) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, err := p.run(&Call{Method: MethodTransaction}); err != nil {
+		return err
+	}
+	return fn(ctx)
+}
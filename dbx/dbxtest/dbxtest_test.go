@@ -0,0 +1,82 @@
+package dbxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cylScripter/chest/dbx"
+	"gorm.io/gorm"
+)
+
+type ModelOrder struct {
+	Id     int32
+	UserId string
+	Status int32
+}
+
+func TestProxy(t *testing.T) {
+	ctx := context.Background()
+	p := New()
+	order := dbx.NewModel(&dbx.ModelConfig{Type: &ModelOrder{}}, p)
+	table := order.NewScope().GetTableName()
+
+	p.On(MethodFind, table).Return([]*ModelOrder{{Id: 1, UserId: "u1"}, {Id: 2, UserId: "u1"}})
+	var list []*ModelOrder
+	if err := order.Where("user_id", "u1").Find(ctx, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[1].Id != 2 {
+		t.Errorf("unexpected list %v", list)
+	}
+
+	var one ModelOrder
+	if err := order.Where("id", 3).First(ctx, &one); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected record not found, got %v", err)
+	}
+
+	p.On(MethodUpdate, "").ReturnRowsAffected(2)
+	res, err := order.Where("user_id", "u1").Update(ctx, map[string]interface{}{"status": 2})
+	if err != nil || res.RowsAffected != 2 {
+		t.Errorf("unexpected update result %v %v", res, err)
+	}
+
+	p.On(MethodDelete, table).ReturnErr(errors.New("boom"))
+	if _, err = order.Where("id", 1).Delete(ctx); err == nil || err.Error() != "boom" {
+		t.Errorf("expected scripted error, got %v", err)
+	}
+
+	p.AssertCalled(t, MethodFind, table, "(`user_id` = ?)", "u1")
+	c := p.AssertCalled(t, MethodUpdate, table, "(`user_id` = ?)")
+	if c != nil && c.Values["status"] != 2 {
+		t.Errorf("unexpected update values %v", c.Values)
+	}
+	p.AssertNotCalled(t, MethodCreate, table)
+	if n := len(p.Calls()); n != 4 {
+		t.Errorf("expected 4 calls, got %d", n)
+	}
+
+	p.On(MethodRows, table).Return([]*ModelOrder{{Id: 5}, {Id: 6}})
+	rows, err := order.NewScope().Rows(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var ids []int32
+	for rows.Next() {
+		var v ModelOrder
+		if err = rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, v.Id)
+	}
+	if len(ids) != 2 || ids[1] != 6 {
+		t.Errorf("unexpected rows %v", ids)
+	}
+
+	p.On(MethodFind, table).Return(int64(7))
+	var sum int64
+	if err = order.NewScope().Sum(ctx, "status", &sum); err != nil || sum != 7 {
+		t.Errorf("unexpected sum %d %v", sum, err)
+	}
+}
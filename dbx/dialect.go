@@ -0,0 +1,312 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dialect 屏蔽不同数据库在连接串、标识符引用和 upsert 语法上的差异，按 DbConfig.DbType 选择
+type Dialect interface {
+	Name() string
+	// Dsn 由 DbConfig 中的连接信息拼出连接串，sqlite 的 dbName 是文件路径
+	Dsn(user, password, ip string, port int, dbName string) string
+	Dialector(dsn string) gorm.Dialector
+	// LazyDialector 与 Dialector 相同，但初始化时不访问数据库，用于打开时可能不可用的从库
+	LazyDialector(dsn string) gorm.Dialector
+	// Quote 引用标识符
+	Quote(name string) string
+	// QuoteIdentifiers Cond 中的标识符统一用反引号书写，执行前转换成方言的写法，单引号内的内容不处理
+	QuoteIdentifiers(sql string) string
+	// Upsert 插入冲突时的子句，updateColumns 为空表示忽略冲突的行
+	Upsert(conflictColumns, updateColumns []string) clause.Expression
+	// UpsertReportsCreated 带更新的 upsert 能否由影响行数区分插入和更新：插入为 1，更新为 2，值没有变化为 0
+	UpsertReportsCreated() bool
+	// UpsertCreatedExpr 带更新的 upsert 在 RETURNING 中判断该行是否为新插入的表达式，不支持 RETURNING 或无法判断时为空
+	UpsertCreatedExpr() string
+	// CrossDatabase 同一个连接能否用 库名.表名 访问同一台服务器上的其他库，不能时 Registry 每个库单独建连接
+	CrossDatabase() bool
+	// EstimateCount 按执行计划估算 query 返回的行数，不支持时返回 ErrEstimateUnsupported
+	EstimateCount(ctx context.Context, pool gorm.ConnPool, query string, vars []interface{}) (int64, error)
+}
+
+var ErrEstimateUnsupported = errors.New("estimate count unsupported")
+
+var (
+	dialectMu sync.RWMutex
+	dialects  = map[string]Dialect{}
+)
+
+func init() {
+	RegisterDialect("mysql", mysqlDialect{})
+	RegisterDialect("postgres", postgresDialect{})
+	RegisterDialect("postgresql", postgresDialect{})
+	RegisterDialect("sqlite", sqliteDialect{})
+	RegisterDialect("sqlite3", sqliteDialect{})
+}
+
+// RegisterDialect 注册 DbConfig.DbType 对应的方言，同名覆盖
+func RegisterDialect(dbType string, d Dialect) {
+	dialectMu.Lock()
+	defer dialectMu.Unlock()
+	dialects[strings.ToLower(dbType)] = d
+}
+
+// GetDialect 返回 dbType 对应的方言，dbType 为空时使用 mysql
+func GetDialect(dbType string) (Dialect, error) {
+	if dbType == "" {
+		dbType = "mysql"
+	}
+	dialectMu.RLock()
+	defer dialectMu.RUnlock()
+	d, ok := dialects[strings.ToLower(dbType)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported db type %s", dbType)
+	}
+	return d, nil
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) Dsn(user, password, ip string, port int, dbName string) string {
+	return fmt.Sprintf("%s:%s@tcp(%v:%v)/%s?charset=utf8&parseTime=True&loc=Local", user, password, ip, port, dbName)
+}
+
+func (mysqlDialect) Dialector(dsn string) gorm.Dialector {
+	return mysql.New(mysqlConfig(dsn, false))
+}
+
+// LazyDialector 不查询 MySQL 版本，按默认配置初始化，只影响建表等 DDL，从库只读不受影响
+func (mysqlDialect) LazyDialector(dsn string) gorm.Dialector {
+	return mysql.New(mysqlConfig(dsn, true))
+}
+
+func mysqlConfig(dsn string, skipVersion bool) mysql.Config {
+	return mysql.Config{
+		DSN:                       dsn,         // DSN data source name
+		DefaultStringSize:         256,         // string 类型字段的默认长度
+		DisableDatetimePrecision:  true,        // 禁用 datetime 精度，MySQL 5.6 之前的数据库不支持
+		DontSupportRenameIndex:    true,        // 重命名索引时采用删除并新建的方式，MySQL 5.7 之前的数据库和 MariaDB 不支持重命名索引
+		DontSupportRenameColumn:   true,        // 用 `change` 重命名列，MySQL 8 之前的数据库和 MariaDB 不支持重命名列
+		SkipInitializeWithVersion: skipVersion, // 为 false 时根据当前 MySQL 版本自动配置
+	}
+}
+
+func (mysqlDialect) Quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (mysqlDialect) QuoteIdentifiers(sql string) string {
+	return sql
+}
+
+func (mysqlDialect) Upsert(conflictColumns, updateColumns []string) clause.Expression {
+	if len(updateColumns) == 0 {
+		return clause.Insert{Modifier: "IGNORE"}
+	}
+	// mysql 按表上的唯一索引判断冲突，ON DUPLICATE KEY UPDATE 不需要指定冲突列
+	return clause.OnConflict{DoUpdates: clause.AssignmentColumns(updateColumns)}
+}
+
+func (mysqlDialect) UpsertReportsCreated() bool {
+	return true
+}
+
+func (mysqlDialect) UpsertCreatedExpr() string {
+	return ""
+}
+
+func (mysqlDialect) CrossDatabase() bool {
+	return true
+}
+
+// EstimateCount 取 EXPLAIN 第一行（驱动表）的 rows
+func (mysqlDialect) EstimateCount(ctx context.Context, pool gorm.ConnPool, query string, vars []interface{}) (int64, error) {
+	rows, err := pool.QueryContext(ctx, "EXPLAIN "+query, vars...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		return 0, fmt.Errorf("empty explain result")
+	}
+	values := make([]interface{}, len(cols))
+	raws := make([]sql.RawBytes, len(cols))
+	for i := range values {
+		values[i] = &raws[i]
+	}
+	if err = rows.Scan(values...); err != nil {
+		return 0, err
+	}
+	for i, c := range cols {
+		if strings.EqualFold(c, "rows") {
+			return strconv.ParseInt(string(raws[i]), 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("rows column not found in explain result")
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) Dsn(user, password, ip string, port int, dbName string) string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Local", ip, user, password, dbName, port)
+}
+
+func (postgresDialect) Dialector(dsn string) gorm.Dialector {
+	return postgres.Open(dsn)
+}
+
+// LazyDialector postgres 初始化时本来就不访问数据库
+func (postgresDialect) LazyDialector(dsn string) gorm.Dialector {
+	return postgres.Open(dsn)
+}
+
+func (postgresDialect) Quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (postgresDialect) QuoteIdentifiers(sql string) string {
+	return replaceBackticks(sql, '"')
+}
+
+func (postgresDialect) Upsert(conflictColumns, updateColumns []string) clause.Expression {
+	return onConflict(conflictColumns, updateColumns)
+}
+
+// UpsertReportsCreated ON CONFLICT DO UPDATE 插入和更新的影响行数都是 1
+func (postgresDialect) UpsertReportsCreated() bool {
+	return false
+}
+
+// UpsertCreatedExpr 新插入的行没有被更新过，系统列 xmax 为 0
+func (postgresDialect) UpsertCreatedExpr() string {
+	return "(xmax = 0)"
+}
+
+// CrossDatabase postgres 的库不是 schema，一个连接只能访问连接串中的库
+func (postgresDialect) CrossDatabase() bool {
+	return false
+}
+
+func (postgresDialect) EstimateCount(ctx context.Context, pool gorm.ConnPool, query string, vars []interface{}) (int64, error) {
+	var plan string
+	if err := pool.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+query, vars...).Scan(&plan); err != nil {
+		return 0, err
+	}
+	var res []struct {
+		Plan struct {
+			PlanRows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan), &res); err != nil {
+		return 0, err
+	}
+	if len(res) == 0 {
+		return 0, fmt.Errorf("empty explain result")
+	}
+	return int64(res[0].Plan.PlanRows), nil
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) Dsn(user, password, ip string, port int, dbName string) string {
+	return dbName
+}
+
+func (sqliteDialect) Dialector(dsn string) gorm.Dialector {
+	return sqlite.Open(dsn)
+}
+
+// LazyDialector sqlite 初始化时查询的是本地文件的版本
+func (sqliteDialect) LazyDialector(dsn string) gorm.Dialector {
+	return sqlite.Open(dsn)
+}
+
+func (sqliteDialect) Quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteIdentifiers sqlite 兼容反引号
+func (sqliteDialect) QuoteIdentifiers(sql string) string {
+	return sql
+}
+
+func (sqliteDialect) Upsert(conflictColumns, updateColumns []string) clause.Expression {
+	return onConflict(conflictColumns, updateColumns)
+}
+
+func (sqliteDialect) UpsertReportsCreated() bool {
+	return false
+}
+
+func (sqliteDialect) UpsertCreatedExpr() string {
+	return ""
+}
+
+// CrossDatabase sqlite 的库名是文件路径，每个文件单独连接
+func (sqliteDialect) CrossDatabase() bool {
+	return false
+}
+
+// EstimateCount sqlite 的执行计划不带行数
+func (sqliteDialect) EstimateCount(ctx context.Context, pool gorm.ConnPool, query string, vars []interface{}) (int64, error) {
+	return 0, ErrEstimateUnsupported
+}
+
+func onConflict(conflictColumns, updateColumns []string) clause.Expression {
+	c := clause.OnConflict{}
+	for _, col := range conflictColumns {
+		c.Columns = append(c.Columns, clause.Column{Name: col})
+	}
+	if len(updateColumns) == 0 {
+		c.DoNothing = true
+	} else {
+		c.DoUpdates = clause.AssignmentColumns(updateColumns)
+	}
+	return c
+}
+
+// replaceBackticks 把单引号外的反引号换成 quote
+func replaceBackticks(sql string, quote byte) string {
+	if strings.IndexByte(sql, '`') < 0 {
+		return sql
+	}
+	b := []byte(sql)
+	inStr := false
+	for i, c := range b {
+		switch {
+		case c == '\'':
+			inStr = !inStr
+		case c == '`' && !inStr:
+			b[i] = quote
+		}
+	}
+	return string(b)
+}
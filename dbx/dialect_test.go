@@ -0,0 +1,22 @@
+package dbx
+
+import "testing"
+
+func TestQuoteIdentifiers(t *testing.T) {
+	pg, err := GetDialect("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := pg.QuoteIdentifiers("(`name` = ?) AND (`note` = 'a`b')")
+	want := `("name" = ?) AND ("note" = 'a` + "`" + `b')`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	my, _ := GetDialect("")
+	if my.Name() != "mysql" {
+		t.Errorf("default dialect %s", my.Name())
+	}
+	if _, err = GetDialect("oracle"); err == nil {
+		t.Error("expected error for unsupported db type")
+	}
+}
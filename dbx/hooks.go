@@ -0,0 +1,190 @@
+package dbx
+
+import (
+	"context"
+	"reflect"
+)
+
+// 模型实现下面的接口后，Scope 在对应的操作前后调用，接收者一般是模型的指针。
+// Before 钩子返回 error 时不执行操作；After 钩子与写操作在同一个事务中执行，返回 error 时回滚，
+// 已在事务中时回滚到进入操作前的保存点，错误原样返回给调用方。
+// Update/Delete 按条件批量执行，钩子在模型的零值上调用。
+// 方法名与 gorm 的钩子相同但签名不同，gorm 不会调用它们，只在解析模型时用全局的 logger.Default
+// 打一条 "don't match AfterFindInterface" 之类的警告，可以忽略；不想看到时在启动时把 logger.Default 设为 Error 级别
+
+// BeforeCreateHook Create/CreateInBatches/Upsert 插入前，在每个待插入的对象上调用，可以修改对象
+type BeforeCreateHook interface {
+	BeforeCreate(ctx context.Context) error
+}
+
+// AfterCreateHook 插入后调用，Upsert 只在插入了新行时调用
+type AfterCreateHook interface {
+	AfterCreate(ctx context.Context) error
+}
+
+// BeforeUpdateHook Update 前调用，可以修改 values；Save 时在对象上调用，values 为 nil
+type BeforeUpdateHook interface {
+	BeforeUpdate(ctx context.Context, values map[string]interface{}) error
+}
+
+// AfterUpdateHook Update/Save 后调用
+type AfterUpdateHook interface {
+	AfterUpdate(ctx context.Context, values map[string]interface{}) error
+}
+
+// BeforeDeleteHook Delete/ForceDelete 前调用
+type BeforeDeleteHook interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// AfterDeleteHook Delete/ForceDelete 后调用
+type AfterDeleteHook interface {
+	AfterDelete(ctx context.Context) error
+}
+
+// AfterFindHook First/Find/FindPaginate/FindByCursor 查到结果后在每个对象上调用
+type AfterFindHook interface {
+	AfterFind(ctx context.Context) error
+}
+
+var (
+	afterCreateHookType = reflect.TypeOf((*AfterCreateHook)(nil)).Elem()
+	afterUpdateHookType = reflect.TypeOf((*AfterUpdateHook)(nil)).Elem()
+	afterDeleteHookType = reflect.TypeOf((*AfterDeleteHook)(nil)).Elem()
+	afterFindHookType   = reflect.TypeOf((*AfterFindHook)(nil)).Elem()
+)
+
+// eachHookTarget 对 dest（结构体指针或切片）中的每个对象调用 fn，传入可以调用指针方法的值
+func eachHookTarget(dest interface{}, fn func(v interface{}) error) error {
+	rv := reflect.ValueOf(dest)
+	if !rv.IsValid() {
+		return nil
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		if el := rv.Elem(); el.Kind() != reflect.Slice && el.Kind() != reflect.Array {
+			return fn(dest)
+		}
+	}
+	list := reflect.Indirect(rv)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return fn(dest)
+	}
+	for i := 0; i < list.Len(); i++ {
+		el := list.Index(i)
+		switch {
+		case el.Kind() == reflect.Ptr:
+			if el.IsNil() {
+				continue
+			}
+		case el.CanAddr():
+			el = el.Addr()
+		}
+		if err := fn(el.Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasHook dest 中的对象是否实现了 hook
+func hasHook(dest interface{}, hook reflect.Type) bool {
+	typ := reflect.TypeOf(dest)
+	if typ == nil {
+		return false
+	}
+	if typ.Kind() == reflect.Ptr && typ.Implements(hook) {
+		return true
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return reflect.PtrTo(typ).Implements(hook)
+}
+
+func callBeforeCreate(ctx context.Context, dest interface{}) error {
+	return eachHookTarget(dest, func(v interface{}) error {
+		if h, ok := v.(BeforeCreateHook); ok {
+			return h.BeforeCreate(ctx)
+		}
+		return nil
+	})
+}
+
+func callAfterCreate(ctx context.Context, dest interface{}) error {
+	return eachHookTarget(dest, func(v interface{}) error {
+		if h, ok := v.(AfterCreateHook); ok {
+			return h.AfterCreate(ctx)
+		}
+		return nil
+	})
+}
+
+func callBeforeUpdate(ctx context.Context, dest interface{}, values map[string]interface{}) error {
+	if h, ok := dest.(BeforeUpdateHook); ok {
+		return h.BeforeUpdate(ctx, values)
+	}
+	return nil
+}
+
+func callAfterUpdate(ctx context.Context, dest interface{}, values map[string]interface{}) error {
+	if h, ok := dest.(AfterUpdateHook); ok {
+		return h.AfterUpdate(ctx, values)
+	}
+	return nil
+}
+
+func callBeforeDelete(ctx context.Context, dest interface{}) error {
+	if h, ok := dest.(BeforeDeleteHook); ok {
+		return h.BeforeDelete(ctx)
+	}
+	return nil
+}
+
+func callAfterDelete(ctx context.Context, dest interface{}) error {
+	if h, ok := dest.(AfterDeleteHook); ok {
+		return h.AfterDelete(ctx)
+	}
+	return nil
+}
+
+func callAfterFind(ctx context.Context, dest interface{}) error {
+	if !hasHook(dest, afterFindHookType) {
+		return nil
+	}
+	return eachHookTarget(dest, func(v interface{}) error {
+		if h, ok := v.(AfterFindHook); ok {
+			return h.AfterFind(ctx)
+		}
+		return nil
+	})
+}
+
+// hookTarget Update/Delete 时调用钩子的模型零值
+func (s *Scope) hookTarget() interface{} {
+	return reflect.New(s.m.typ).Interface()
+}
+
+// transactionOn 可以按库名开启事务的 DbProxy，如 Registry
+type transactionOn interface {
+	TransactionOn(ctx context.Context, name string, fn func(ctx context.Context) error) error
+}
+
+// withAfterHook need 为 true 时在事务中执行 fn，让 After 钩子的错误回滚写操作
+func (s *Scope) withAfterHook(ctx context.Context, need bool, fn func(ctx context.Context) error) error {
+	if !need {
+		return fn(ctx)
+	}
+	if r, ok := s.m.proxy.(transactionOn); ok {
+		return r.TransactionOn(ctx, s.db, fn)
+	}
+	return s.m.proxy.Transaction(ctx, fn)
+}
@@ -0,0 +1,77 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type ModelHookItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+	Label     string `json:"-" gorm:"-"`
+}
+
+var errBadName = errors.New("bad name")
+
+func (m *ModelHookItem) BeforeCreate(ctx context.Context) error {
+	m.Name = strings.ToLower(strings.TrimSpace(m.Name))
+	return nil
+}
+
+func (m *ModelHookItem) AfterCreate(ctx context.Context) error {
+	if m.Name == "bad" {
+		return errBadName
+	}
+	return nil
+}
+
+func (m *ModelHookItem) BeforeUpdate(ctx context.Context, values map[string]interface{}) error {
+	if name, ok := values["name"].(string); ok {
+		values["name"] = strings.ToLower(name)
+	}
+	return nil
+}
+
+func (m *ModelHookItem) AfterFind(ctx context.Context) error {
+	m.Label = "#" + m.Name
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelHookItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelHookItem{}}, orm)
+	obj := &ModelHookItem{Name: " Alice "}
+	if err := item.Create(ctx, obj); err != nil || obj.Name != "alice" {
+		t.Fatalf("unexpected create %v %v", obj, err)
+	}
+	if err := item.Create(ctx, &ModelHookItem{Name: "BAD"}); !errors.Is(err, errBadName) {
+		t.Errorf("expected hook error, got %v", err)
+	}
+	err := orm.Transaction(ctx, func(ctx context.Context) error {
+		if err := item.Create(ctx, &ModelHookItem{Name: "bob"}); err != nil {
+			return err
+		}
+		_, err := item.NewScope().CreateInBatches(ctx, []*ModelHookItem{{Name: "carol"}, {Name: "bad"}}, 0)
+		return err
+	})
+	if !errors.Is(err, errBadName) {
+		t.Errorf("expected hook error, got %v", err)
+	}
+	if _, err = item.Where("name", "alice").Update(ctx, map[string]interface{}{"name": "ALICE2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var list []*ModelHookItem
+	if err = item.NewScope().OrderAsc("id").Find(ctx, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "alice2" || list[0].Label != "#alice2" {
+		t.Errorf("unexpected rows %+v", list)
+	}
+}
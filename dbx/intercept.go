@@ -0,0 +1,211 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cylScripter/openapi/base"
+)
+
+// DbProxy 的操作名，Op.Name 的取值
+const (
+	OpFirst           = "First"
+	OpFind            = "Find"
+	OpCreate          = "Create"
+	OpCreateInBatches = "CreateInBatches"
+	OpUpsert          = "Upsert"
+	OpToSql           = "ToSql"
+	OpFindPaginate    = "FindPaginate"
+	OpCount           = "Count"
+	OpDelete          = "Delete"
+	OpAutoMigrate     = "AutoMigrate"
+	OpUpdate          = "Update"
+	OpSave            = "Save"
+	OpTransaction     = "Transaction"
+	OpRows            = "Rows"
+)
+
+// Op 一次 DbProxy 调用，Where 和 Create 最多一个非空，Transaction 时 Dest 为事务函数，AutoMigrate 时为 []interface{}
+type Op struct {
+	Name   string
+	Where  *WhereReq
+	Create *CreateReq
+	Dest   interface{}
+	// Values Update 的字段
+	Values map[string]interface{}
+	// Result 调用返回后的结果：Create/CreateInBatches 为 CreateResult，Upsert 为 UpdateOrCreateResult，
+	// Update 为 UpdateResult，Delete 为 DeleteResult，FindPaginate 为 *base.Paginate，Count 为 int64，
+	// ToSql 为 string，Rows 为 *Rows，其他为 nil
+	Result interface{}
+}
+
+// Table 操作的表名
+func (o *Op) Table() string {
+	switch {
+	case o.Where != nil:
+		return o.Where.TableName
+	case o.Create != nil:
+		return o.Create.TableName
+	}
+	return ""
+}
+
+// Endpoint 执行 op，与 Kitex 的 endpoint.Endpoint 类似
+type Endpoint func(ctx context.Context, op *Op) error
+
+// Interceptor 包装 Endpoint，在调用 next 前后做追踪、指标、审计、熔断、故障注入等，
+// 可以修改 op 的请求、直接返回错误而不调用 next，或在 next 返回后读取 op.Result
+type Interceptor func(next Endpoint) Endpoint
+
+// Chain 把多个拦截器合成一个，第一个在最外层
+func Chain(list ...Interceptor) Interceptor {
+	return func(next Endpoint) Endpoint {
+		for i := len(list) - 1; i >= 0; i-- {
+			next = list[i](next)
+		}
+		return next
+	}
+}
+
+// Intercept 返回在 proxy 外包上拦截器链的 DbProxy，用于 NewModel，如
+// NewModel(cfg, dbx.Intercept(db, tracing, metrics))，list 中第一个在最外层
+func Intercept(proxy DbProxy, list ...Interceptor) DbProxy {
+	p := &interceptProxy{next: proxy}
+	p.endpoint = Chain(list...)(p.invoke)
+	return p
+}
+
+type interceptProxy struct {
+	next     DbProxy
+	endpoint Endpoint
+}
+
+// invoke 最内层的 Endpoint，按 op.Name 调用被包装的 DbProxy
+func (p *interceptProxy) invoke(ctx context.Context, op *Op) error {
+	var err error
+	switch op.Name {
+	case OpFirst:
+		err = p.next.First(ctx, op.Where, op.Dest)
+	case OpFind:
+		err = p.next.Find(ctx, op.Where, op.Dest)
+	case OpCreate:
+		err = p.next.Create(ctx, op.Create, op.Dest)
+	case OpCreateInBatches:
+		op.Result, err = p.next.CreateInBatches(ctx, op.Create, op.Dest)
+	case OpUpsert:
+		op.Result, err = p.next.Upsert(ctx, op.Create, op.Dest)
+	case OpToSql:
+		op.Result, err = p.next.ToSql(ctx, op.Where, op.Dest)
+	case OpFindPaginate:
+		op.Result, err = p.next.FindPaginate(ctx, op.Where, op.Dest)
+	case OpCount:
+		op.Result, err = p.next.Count(ctx, op.Where, op.Dest)
+	case OpDelete:
+		op.Result, err = p.next.Delete(ctx, op.Where, op.Dest)
+	case OpAutoMigrate:
+		err = p.next.AutoMigrate(op.Dest.([]interface{})...)
+	case OpUpdate:
+		op.Result, err = p.next.Update(ctx, op.Where, op.Dest, op.Values)
+	case OpSave:
+		err = p.next.Save(ctx, op.Where, op.Dest)
+	case OpTransaction:
+		fn := op.Dest.(func(ctx context.Context) error)
+		if r, ok := p.next.(transactionOn); ok && op.Where != nil {
+			err = r.TransactionOn(ctx, op.Where.Db, fn)
+		} else {
+			err = p.next.Transaction(ctx, fn)
+		}
+	case OpRows:
+		op.Result, err = p.next.Rows(ctx, op.Where, op.Dest)
+	default:
+		err = fmt.Errorf("unknown op %s", op.Name)
+	}
+	return err
+}
+
+func (p *interceptProxy) First(ctx context.Context, req *WhereReq, dest interface{}) error {
+	return p.endpoint(ctx, &Op{Name: OpFirst, Where: req, Dest: dest})
+}
+
+func (p *interceptProxy) Find(ctx context.Context, req *WhereReq, dest interface{}) error {
+	return p.endpoint(ctx, &Op{Name: OpFind, Where: req, Dest: dest})
+}
+
+func (p *interceptProxy) Create(ctx context.Context, req *CreateReq, dest interface{}) error {
+	return p.endpoint(ctx, &Op{Name: OpCreate, Create: req, Dest: dest})
+}
+
+func (p *interceptProxy) CreateInBatches(ctx context.Context, req *CreateReq, dest interface{}) (CreateResult, error) {
+	op := &Op{Name: OpCreateInBatches, Create: req, Dest: dest}
+	err := p.endpoint(ctx, op)
+	res, _ := op.Result.(CreateResult)
+	return res, err
+}
+
+func (p *interceptProxy) Upsert(ctx context.Context, req *CreateReq, dest interface{}) (UpdateOrCreateResult, error) {
+	op := &Op{Name: OpUpsert, Create: req, Dest: dest}
+	err := p.endpoint(ctx, op)
+	res, _ := op.Result.(UpdateOrCreateResult)
+	return res, err
+}
+
+func (p *interceptProxy) ToSql(ctx context.Context, req *WhereReq, dest interface{}) (string, error) {
+	op := &Op{Name: OpToSql, Where: req, Dest: dest}
+	err := p.endpoint(ctx, op)
+	res, _ := op.Result.(string)
+	return res, err
+}
+
+func (p *interceptProxy) FindPaginate(ctx context.Context, req *WhereReq, dest interface{}) (*base.Paginate, error) {
+	op := &Op{Name: OpFindPaginate, Where: req, Dest: dest}
+	err := p.endpoint(ctx, op)
+	res, _ := op.Result.(*base.Paginate)
+	return res, err
+}
+
+func (p *interceptProxy) Count(ctx context.Context, req *WhereReq, dest interface{}) (int64, error) {
+	op := &Op{Name: OpCount, Where: req, Dest: dest}
+	err := p.endpoint(ctx, op)
+	res, _ := op.Result.(int64)
+	return res, err
+}
+
+func (p *interceptProxy) Delete(ctx context.Context, req *WhereReq, dest interface{}) (DeleteResult, error) {
+	op := &Op{Name: OpDelete, Where: req, Dest: dest}
+	err := p.endpoint(ctx, op)
+	res, _ := op.Result.(DeleteResult)
+	return res, err
+}
+
+// AutoMigrate 没有 ctx，拦截器收到的是 context.Background()
+func (p *interceptProxy) AutoMigrate(dest ...interface{}) error {
+	return p.endpoint(context.Background(), &Op{Name: OpAutoMigrate, Dest: dest})
+}
+
+func (p *interceptProxy) Update(ctx context.Context, req *WhereReq, dest interface{}, values map[string]interface{}) (UpdateResult, error) {
+	op := &Op{Name: OpUpdate, Where: req, Dest: dest, Values: values}
+	err := p.endpoint(ctx, op)
+	res, _ := op.Result.(UpdateResult)
+	return res, err
+}
+
+func (p *interceptProxy) Save(ctx context.Context, req *WhereReq, dest interface{}) error {
+	return p.endpoint(ctx, &Op{Name: OpSave, Where: req, Dest: dest})
+}
+
+// Transaction 拦截器包在整个事务外，事务中的操作再各自经过拦截器
+func (p *interceptProxy) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return p.endpoint(ctx, &Op{Name: OpTransaction, Dest: fn})
+}
+
+// TransactionOn 被包装的是 Registry 时在 name 对应的库上开启事务，否则与 Transaction 相同，Where.Db 为 name
+func (p *interceptProxy) TransactionOn(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	return p.endpoint(ctx, &Op{Name: OpTransaction, Where: &WhereReq{Db: name}, Dest: fn})
+}
+
+func (p *interceptProxy) Rows(ctx context.Context, req *WhereReq, dest interface{}) (*Rows, error) {
+	op := &Op{Name: OpRows, Where: req, Dest: dest}
+	err := p.endpoint(ctx, op)
+	res, _ := op.Result.(*Rows)
+	return res, err
+}
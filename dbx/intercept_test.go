@@ -0,0 +1,78 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type ModelInterceptItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestIntercept(t *testing.T) {
+	ctx := context.Background()
+	var trace []string
+	record := func(tag string) Interceptor {
+		return func(next Endpoint) Endpoint {
+			return func(ctx context.Context, op *Op) error {
+				trace = append(trace, tag+">"+op.Name+":"+op.Table())
+				err := next(ctx, op)
+				if op.Name == OpUpdate {
+					trace = append(trace, fmt.Sprintf("%s<%s:%d", tag, op.Name, op.Result.(UpdateResult).RowsAffected))
+				}
+				return err
+			}
+		}
+	}
+	boom := errors.New("boom")
+	deny := func(next Endpoint) Endpoint {
+		return func(ctx context.Context, op *Op) error {
+			if op.Name == OpDelete {
+				return boom
+			}
+			return next(ctx, op)
+		}
+	}
+	proxy := Intercept(orm, record("a"), record("b"), deny)
+	if err := proxy.AutoMigrate(&ModelInterceptItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelInterceptItem{}}, proxy)
+	err := item.Transaction(ctx, func(ctx context.Context) error {
+		if err := item.Create(ctx, &ModelInterceptItem{Name: "a"}); err != nil {
+			return err
+		}
+		_, err := item.Where("name", "a").Update(ctx, map[string]interface{}{"name": "b"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = item.Where("name", "b").Delete(ctx); !errors.Is(err, boom) {
+		t.Errorf("expected interceptor error, got %v", err)
+	}
+	n, err := item.Where("name", "b").Count(ctx)
+	if err != nil || n != 1 {
+		t.Errorf("unexpected count %d %v", n, err)
+	}
+	want := []string{
+		"a>AutoMigrate:", "b>AutoMigrate:",
+		"a>Transaction:", "b>Transaction:",
+		"a>Create:dbx_intercept_item", "b>Create:dbx_intercept_item",
+		"a>Update:dbx_intercept_item", "b>Update:dbx_intercept_item", "b<Update:1", "a<Update:1",
+		"a>Delete:dbx_intercept_item", "b>Delete:dbx_intercept_item",
+		"a>Count:dbx_intercept_item", "b>Count:dbx_intercept_item",
+	}
+	if len(trace) != len(want) {
+		t.Fatalf("unexpected trace %v", trace)
+	}
+	for i := range want {
+		if trace[i] != want[i] {
+			t.Errorf("trace[%d] = %s, want %s", i, trace[i], want[i])
+		}
+	}
+}
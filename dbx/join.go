@@ -0,0 +1,182 @@
+package dbx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// As 主表的别名，条件、字段和排序中不带表名的字段会加上这个别名，Join 时默认为表名
+func (s *Scope) As(alias string) *Scope {
+	s.alias = alias
+	return s
+}
+
+// Join 内连接 table，table 可以写成 "orders o" 或 "orders AS o"，on 的写法与 Where 相同，
+// 两个表的字段比较写成 sql，如 Join("orders o", "o.user_id = u.id AND o.status = ?", 1)
+// 或 Join("orders o", map[string]interface{}{"$raw": "o.user_id = u.id", "o.status": 1})。
+// Join 后 Where/Select/OrderAsc/Group 中不带表名的字段自动加上主表的别名，
+// 没有 Select 时只查主表的字段，需要其他表的字段时在 Select 中带上表名，结果按列名扫描到 dest 的字段
+func (s *Scope) Join(table string, on ...interface{}) *Scope {
+	return s.join("JOIN", table, on...)
+}
+
+// LeftJoin 左连接 table，见 Join
+func (s *Scope) LeftJoin(table string, on ...interface{}) *Scope {
+	return s.join("LEFT JOIN", table, on...)
+}
+
+// RightJoin 右连接 table，见 Join，sqlite 3.39 之前不支持
+func (s *Scope) RightJoin(table string, on ...interface{}) *Scope {
+	return s.join("RIGHT JOIN", table, on...)
+}
+
+func (s *Scope) join(kind, table string, on ...interface{}) *Scope {
+	sql := fmt.Sprintf("%s %s", kind, quoteTableAlias(table))
+	c := Cond{isTopLevel: true}
+	if len(on) > 0 {
+		c.Where(on...)
+	}
+	s.cond.inherit(&c)
+	if cond := c.ToString(); cond != "" {
+		sql = fmt.Sprintf("%s ON %s", sql, cond)
+	}
+	s.joins = append(s.joins, Expr{Sql: sql, Args: c.args})
+	return s
+}
+
+// quoteTableAlias 引用 "table alias" / "table AS alias" 中的表名和别名
+func quoteTableAlias(table string) string {
+	parts := strings.Fields(table)
+	switch {
+	case len(parts) == 2:
+		return fmt.Sprintf("%s %s", quoteFieldName(parts[0]), quoteFieldName(parts[1]))
+	case len(parts) == 3 && strings.EqualFold(parts[1], "AS"):
+		return fmt.Sprintf("%s AS %s", quoteFieldName(parts[0]), quoteFieldName(parts[2]))
+	case len(parts) == 1:
+		return quoteFieldName(parts[0])
+	}
+	return table
+}
+
+// qualifier 给字段加的主表别名，设置了 As 时为别名，否则 Join 时为表名，都没有时为空
+func (s *Scope) qualifier() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	if len(s.joins) == 0 {
+		return ""
+	}
+	table := s.GetTableName()
+	if idx := strings.LastIndexByte(table, '.'); idx >= 0 {
+		table = table[idx+1:]
+	}
+	return table
+}
+
+// condExpr 查询用的条件，给不带表名的字段加上主表别名
+func (s *Scope) condExpr() Expr {
+	e := s.cond.ToExpr()
+	if alias := s.qualifier(); alias != "" {
+		e.Sql = qualifyIdentifiers(e.Sql, alias)
+	}
+	return e
+}
+
+// selectColumns 查询的字段，给不带表名的字段加上主表别名，没有指定时只查主表的字段
+func (s *Scope) selectColumns() []string {
+	alias := s.qualifier()
+	if alias == "" {
+		return s.selects
+	}
+	if len(s.selects) == 0 {
+		return []string{quoteFieldName(alias) + ".*"}
+	}
+	return qualifyColumns(s.selects, alias)
+}
+
+func qualifyColumns(cols []string, alias string) []string {
+	res := make([]string, 0, len(cols))
+	for _, c := range cols {
+		res = append(res, qualifyColumn(c, alias))
+	}
+	return res
+}
+
+// qualifyColumn 只处理单独的字段名、table.field 和 *，表达式原样返回
+func qualifyColumn(col, alias string) string {
+	c := strings.TrimSpace(col)
+	if c == "*" {
+		return quoteFieldName(alias) + ".*"
+	}
+	name := strings.ReplaceAll(c, "`", "")
+	if name == "" || getFirstInvalidFieldNameCharIndex(name) >= 0 {
+		return col
+	}
+	if strings.IndexByte(name, '.') < 0 {
+		name = alias + "." + name
+	}
+	return quoteFieldName(name)
+}
+
+// qualifyIdentifiers 给 sql 中前后都不是 . 的反引号标识符加上 alias，单引号内的内容和 (SELECT ...) 子查询不处理
+func qualifyIdentifiers(sql, alias string) string {
+	if strings.IndexByte(sql, '`') < 0 {
+		return sql
+	}
+	prefix := quoteFieldName(alias) + "."
+	var b strings.Builder
+	inStr := false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		if c == '\'' {
+			inStr = !inStr
+		}
+		if c == '(' && !inStr && hasPrefixFold(sql[i+1:], "SELECT ") {
+			end := matchParen(sql, i)
+			b.WriteString(sql[i : end+1])
+			i = end
+			continue
+		}
+		if c != '`' || inStr {
+			b.WriteByte(c)
+			continue
+		}
+		end := strings.IndexByte(sql[i+1:], '`')
+		if end < 0 {
+			b.WriteString(sql[i:])
+			break
+		}
+		end += i + 1
+		if (i == 0 || sql[i-1] != '.') && (end+1 >= len(sql) || sql[end+1] != '.') {
+			b.WriteString(prefix)
+		}
+		b.WriteString(sql[i : end+1])
+		i = end
+	}
+	return b.String()
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// matchParen 返回与 sql[start] 的左括号匹配的右括号位置，没有时返回最后一个字符的位置
+func matchParen(sql string, start int) int {
+	depth := 0
+	inStr := false
+	for i := start; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'':
+			inStr = !inStr
+		case inStr:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(sql) - 1
+}
@@ -0,0 +1,93 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+)
+
+type ModelJoinUser struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+type ModelJoinOrder struct {
+	Id        int32 `json:"id"`
+	UserId    int32 `json:"user_id"`
+	Amount    int32 `json:"amount"`
+	Status    int32 `json:"status"`
+	DeletedAt int32 `json:"deleted_at"`
+}
+
+type joinOrderView struct {
+	Id     int32
+	UserId int32
+	Amount int32
+	Name   string
+}
+
+func TestJoin(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelJoinUser{}, &ModelJoinOrder{}); err != nil {
+		t.Fatal(err)
+	}
+	user := NewModel(&ModelConfig{Type: &ModelJoinUser{}}, orm)
+	order := NewModel(&ModelConfig{Type: &ModelJoinOrder{}}, orm)
+	for _, u := range []*ModelJoinUser{{Id: 1, Name: "alice"}, {Id: 2, Name: "bob"}} {
+		if err := user.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, o := range []*ModelJoinOrder{
+		{Id: 1, UserId: 1, Amount: 10, Status: 1},
+		{Id: 2, UserId: 2, Amount: 30, Status: 1},
+		{Id: 3, UserId: 1, Amount: 20, Status: 0},
+		{Id: 4, UserId: 3, Amount: 40, Status: 1},
+	} {
+		if err := order.Create(ctx, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var list []*joinOrderView
+	err := order.NewScope().As("o").
+		Join("dbx_join_user u", map[string]interface{}{"$raw": "u.id = o.user_id", "u.deleted_at": 0}).
+		Select("id", "user_id", "amount", "u.name").
+		Where("status", 1).
+		OrderDesc("amount").
+		Find(ctx, &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Id != 2 || list[0].Name != "bob" || list[1].Name != "alice" {
+		t.Errorf("unexpected rows %+v", list)
+	}
+
+	list = nil
+	err = order.NewScope().
+		LeftJoin("dbx_join_user AS u", "u.id = dbx_join_order.user_id").
+		Select("*", "u.name").
+		Where("amount", ">", 15).
+		OrderAsc("id").
+		Find(ctx, &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Name != "bob" || list[2].Id != 4 || list[2].Name != "" {
+		t.Errorf("unexpected rows %+v", list)
+	}
+
+	var one joinOrderView
+	err = order.NewScope().As("o").Join("dbx_join_user u", "u.id = o.user_id").Where("u.name", "alice").First(ctx, &one)
+	if err != nil || one.Id != 1 {
+		t.Errorf("unexpected row %+v %v", one, err)
+	}
+}
+
+func TestQualifyIdentifiers(t *testing.T) {
+	got := qualifyIdentifiers("(`a` = ?) AND (`u`.`b` = 'x `c`') AND `d` IS NULL", "o")
+	want := "(`o`.`a` = ?) AND (`u`.`b` = 'x `c`') AND `o`.`d` IS NULL"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
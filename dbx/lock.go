@@ -0,0 +1,81 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrLockOutsideTransaction 不在事务中使用 ForUpdate/ForShare，锁会在语句结束时立即释放
+var ErrLockOutsideTransaction = errors.New("row lock requires a transaction")
+
+const (
+	// LockForUpdate SELECT ... FOR UPDATE
+	LockForUpdate = clause.LockingStrengthUpdate
+	// LockForShare SELECT ... FOR SHARE，mysql 需要 8.0 以上
+	LockForShare = clause.LockingStrengthShare
+)
+
+// Lock First/Find 的行锁，sqlite 不支持行锁，忽略
+type Lock struct {
+	// Strength LockForUpdate 或 LockForShare
+	Strength string
+	// Options 空、SKIP LOCKED 或 NOWAIT
+	Options string
+}
+
+// ForUpdate First/Find 加 FOR UPDATE 锁住查到的行直到事务结束，需要在 Transaction 的 ctx 中调用，否则返回 ErrLockOutsideTransaction
+func (s *Scope) ForUpdate() *Scope {
+	s.lockStrength(LockForUpdate)
+	return s
+}
+
+// ForShare First/Find 加 FOR SHARE 共享锁，见 ForUpdate
+func (s *Scope) ForShare() *Scope {
+	s.lockStrength(LockForShare)
+	return s
+}
+
+// SkipLocked 跳过已被其他事务锁住的行，没有调用 ForShare 时为 FOR UPDATE
+func (s *Scope) SkipLocked() *Scope {
+	s.lockOptions(clause.LockingOptionsSkipLocked)
+	return s
+}
+
+// NoWait 行已被其他事务锁住时立即返回错误而不是等待，没有调用 ForShare 时为 FOR UPDATE
+func (s *Scope) NoWait() *Scope {
+	s.lockOptions(clause.LockingOptionsNoWait)
+	return s
+}
+
+func (s *Scope) lockStrength(strength string) {
+	if s.lock == nil {
+		s.lock = &Lock{}
+	}
+	s.lock.Strength = strength
+}
+
+func (s *Scope) lockOptions(options string) {
+	if s.lock == nil {
+		s.lock = &Lock{Strength: LockForUpdate}
+	}
+	s.lock.Options = options
+}
+
+// checkLock 加锁的查询必须在事务中
+func (p *Db) checkLock(ctx context.Context, req *WhereReq) error {
+	if req.Lock != nil && !p.InTransaction(ctx) {
+		return ErrLockOutsideTransaction
+	}
+	return nil
+}
+
+// locking 加上 FOR UPDATE/FOR SHARE 子句
+func (p *Db) locking(query *gorm.DB, req *WhereReq) *gorm.DB {
+	if req.Lock == nil {
+		return query
+	}
+	return query.Clauses(clause.Locking{Strength: req.Lock.Strength, Options: req.Lock.Options})
+}
@@ -0,0 +1,47 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type ModelLockItem struct {
+	Id        int32 `json:"id"`
+	Stock     int32 `json:"stock"`
+	DeletedAt int32 `json:"deleted_at"`
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelLockItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelLockItem{}}, orm)
+	if err := item.Create(ctx, &ModelLockItem{Stock: 3}); err != nil {
+		t.Fatal(err)
+	}
+	var got ModelLockItem
+	if err := item.NewScope().ForUpdate().First(ctx, &got); !errors.Is(err, ErrLockOutsideTransaction) {
+		t.Errorf("expected ErrLockOutsideTransaction, got %v", err)
+	}
+	var list []*ModelLockItem
+	if err := item.NewScope().SkipLocked().Find(ctx, &list); !errors.Is(err, ErrLockOutsideTransaction) {
+		t.Errorf("expected ErrLockOutsideTransaction, got %v", err)
+	}
+	err := orm.Transaction(ctx, func(ctx context.Context) error {
+		var row ModelLockItem
+		if err := item.NewScope().ForUpdate().NoWait().First(ctx, &row); err != nil {
+			return err
+		}
+		_, err := item.Where("id", row.Id).Update(ctx, map[string]interface{}{"stock": row.Stock - 1})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := item.NewScope().ForShare().SkipLocked()
+	if s.lock.Strength != LockForShare || s.lock.Options != "SKIP LOCKED" {
+		t.Errorf("unexpected lock %+v", s.lock)
+	}
+}
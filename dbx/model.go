@@ -11,6 +11,10 @@ type ModelConfig struct {
 	Type            interface{}
 	NotFoundErrCode int
 	Db              string
+	// SoftDelete 软删除策略，默认 deleted_at 整数秒时间戳
+	SoftDelete SoftDelete
+	// Timestamps 自动写入的创建和更新时间，默认 created_at/updated_at 整数秒
+	Timestamps Timestamps
 }
 
 type Model struct {
@@ -51,6 +55,11 @@ func (p *Model) UnScoped() *Scope {
 	s.Unscoped()
 	return s
 }
+func (p *Model) OnlyTrashed() *Scope {
+	s := p.NewScope()
+	s.OnlyTrashed()
+	return s
+}
 func (p *Model) Where(whereCond ...interface{}) *Scope {
 	s := p.NewScope()
 	s.cond.Where(whereCond...)
@@ -75,10 +84,22 @@ func (p *Model) FirstOrCreate(ctx context.Context, attributes map[string]interfa
 	return p.NewScope().FirstOrCreate(ctx, attributes, values, obj)
 }
 
+func (p *Model) Upsert(ctx context.Context, obj interface{}, conflictColumns []string, updateColumns []string) (UpdateOrCreateResult, error) {
+	return p.NewScope().Upsert(ctx, obj, conflictColumns, updateColumns)
+}
+
 func (p *Model) FirstOrUpdate(ctx context.Context, attributes map[string]interface{}, values map[string]interface{}, obj interface{}) (FirstOrCreateResult, error) {
 	return p.NewScope().FirstOrUpdate(ctx, attributes, values, obj)
 }
 
+// Transaction 在 Model 所在库上开启事务，见 Db.Transaction
+func (p *Model) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r, ok := p.proxy.(transactionOn); ok {
+		return r.TransactionOn(ctx, p.Db, fn)
+	}
+	return p.proxy.Transaction(ctx, fn)
+}
+
 func (p *Model) Save(ctx context.Context, dest interface{}) error {
 	s := p.NewScope()
 	return s.Save(ctx, dest)
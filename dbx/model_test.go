@@ -3,7 +3,11 @@ package dbx
 import (
 	"context"
 	"github.com/cylScripter/chest/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"strings"
 	"testing"
+	"time"
 )
 
 type ModelUser struct {
@@ -30,22 +34,21 @@ var orm *Db
 func init() {
 	var err error
 	orm, err = NewDb(DbConfig{
-		DbName:   "test",
-		DbType:   "mysql",
-		Ip:       "106.53.50.226",
-		Port:     19457,
-		User:     "root",
-		Password: "Jy18300015530@",
+		DbName: "file:dbx_test?mode=memory&cache=shared",
+		DbType: "sqlite",
 	})
 	if err != nil {
 		panic(err)
 	}
+	if err = orm.AutoMigrate(&ModelUser{}); err != nil {
+		panic(err)
+	}
 
 	User = &TUser{
 		Model: NewModel(&ModelConfig{
-			&ModelUser{},
-			5000,
-			"user",
+			Type:            &ModelUser{},
+			NotFoundErrCode: 5000,
+			Db:              "user",
 		}, orm),
 	}
 }
@@ -57,11 +60,13 @@ func TestNewModel(t *testing.T) {
 	var userList []*ModelUser
 	err := User.NewScope().Where("deleted_at", 0).Find(context.Background(), &userList)
 	if err != nil {
-		log.Infof("err:%v", err)
-		return
+		t.Fatalf("err:%v", err)
 	}
 
 	sql, err := User.NewScope().Select("id").Where("deleted_at", 0).OrderAsc("id").ToSql(context.Background(), &userList)
+	if err != nil {
+		t.Fatalf("err:%v", err)
+	}
 	log.Infof("sql:%v", sql)
 
 	err = orm.AutoMigrate(&ModelUser{})
@@ -70,3 +75,336 @@ func TestNewModel(t *testing.T) {
 	}
 
 }
+
+type ModelPaginateItem struct {
+	Id        int32  `json:"id"`
+	Kind      string `json:"kind"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestFindPaginate(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelPaginateItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelPaginateItem{}}, orm)
+	for i := 1; i <= 10; i++ {
+		kind := "a"
+		if i > 7 {
+			kind = "b"
+		}
+		if err := item.Create(ctx, &ModelPaginateItem{Id: int32(i), Kind: kind}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		strategy CountStrategy
+		offset   uint32
+		total    int32
+		n        int
+	}{
+		{CountExact, 0, 7, 3},
+		{CountEstimate, 0, 7, 3},
+		{CountSkip, 0, 4, 3},
+		{CountSkip, 6, 7, 1},
+	}
+	for _, c := range cases {
+		var list []*ModelPaginateItem
+		page, err := item.Where("kind", "a").OrderAsc("id").SetLimit(3).SetOffset(c.offset).
+			SetCountStrategy(c.strategy).FindPaginate(ctx, &list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != c.total || len(list) != c.n {
+			t.Errorf("strategy %d offset %d: total %d len %d, want %d %d", c.strategy, c.offset, page.Total, len(list), c.total, c.n)
+		}
+	}
+}
+
+type ModelBatchItem struct {
+	Id        int32  `json:"id"`
+	Code      string `json:"code" gorm:"uniqueIndex"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestCreateInBatches(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelBatchItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelBatchItem{}}, orm)
+	list := []*ModelBatchItem{{Code: "a"}, {Code: "b"}, {Code: "c"}}
+	res, err := item.NewScope().CreateInBatches(ctx, list, 2)
+	if err != nil || res.Inserted != 3 || res.Skipped != 0 {
+		t.Fatalf("unexpected result %v %v", res, err)
+	}
+	if _, err = item.NewScope().CreateInBatches(ctx, []*ModelBatchItem{{Code: "a"}}, 0); err == nil {
+		t.Errorf("expected unique conflict error")
+	}
+	res, err = item.NewScope().IgnoreConflict().CreateInBatches(ctx, []*ModelBatchItem{{Code: "b"}, {Code: "d"}, {Code: "c"}}, 2)
+	if err != nil || res.Inserted != 1 || res.Skipped != 2 {
+		t.Errorf("unexpected result %v %v", res, err)
+	}
+	var all []*ModelBatchItem
+	if err = item.NewScope().Find(ctx, &all); err != nil || len(all) != 4 {
+		t.Errorf("expected 4 rows, got %d %v", len(all), err)
+	}
+}
+
+type ModelUpsertItem struct {
+	Id        int32  `json:"id"`
+	Code      string `json:"code" gorm:"uniqueIndex"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestUpsert(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelUpsertItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelUpsertItem{}}, orm)
+	res, err := item.Upsert(ctx, &ModelUpsertItem{Code: "a", Name: "n1"}, []string{"code"}, []string{"name"})
+	if err != nil || !res.Created || res.RowsAffected != 1 {
+		t.Fatalf("unexpected result %v %v", res, err)
+	}
+	res, err = item.Upsert(ctx, &ModelUpsertItem{Code: "a", Name: "n2"}, []string{"code"}, []string{"name"})
+	if err != nil || res.Created || res.RowsAffected != 1 {
+		t.Fatalf("unexpected result %v %v", res, err)
+	}
+	res, err = item.Upsert(ctx, &ModelUpsertItem{Code: "a", Name: "n3"}, []string{"code"}, nil)
+	if err != nil || res.Created || res.RowsAffected != 0 {
+		t.Fatalf("unexpected result %v %v", res, err)
+	}
+	var got ModelUpsertItem
+	if err = item.Where("code", "a").First(ctx, &got); err != nil || got.Name != "n2" {
+		t.Errorf("unexpected row %v %v", got, err)
+	}
+
+	var obj ModelUpsertItem
+	r, err := item.FirstOrCreate(ctx, map[string]interface{}{"code": "b"}, map[string]interface{}{"name": "n1"}, &obj)
+	if err != nil || !r.Created || obj.Id == 0 {
+		t.Fatalf("unexpected result %v %v %v", r, obj, err)
+	}
+	var again ModelUpsertItem
+	r, err = item.FirstOrCreate(ctx, map[string]interface{}{"code": "b"}, map[string]interface{}{"name": "n2"}, &again)
+	if err != nil || r.Created || again.Id != obj.Id || again.Name != "n1" {
+		t.Errorf("unexpected result %v %v %v", r, again, err)
+	}
+}
+
+func TestUpsertReturningSql(t *testing.T) {
+	d := postgresDialect{}
+	g, err := gorm.Open(d.Dialector(d.Dsn("u", "p", "127.0.0.1", 5432, "db")), &gorm.Config{DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &Db{db: g, dialect: d}
+	req := &CreateReq{ConflictColumns: []string{"code"}, UpdateColumns: []string{"name"}}
+	query, err := db.upsertReturningQuery(context.Background(), req, &ModelUpsertItem{Code: "a", Name: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// postgres 由一条语句完成 upsert 并返回是否为新行
+	sql := query.Statement.SQL.String()
+	want := `ON CONFLICT ("code") DO UPDATE SET "name"="excluded"."name" RETURNING (xmax = 0) AS "dbx_upsert_created","id"`
+	if !strings.HasPrefix(sql, "INSERT INTO ") || !strings.HasSuffix(sql, want) {
+		t.Errorf("unexpected sql %s", sql)
+	}
+}
+
+type ModelSoftFlagItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	IsDeleted bool   `json:"is_deleted"`
+}
+
+type ModelHardItem struct {
+	Id   int32  `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelSoftFlagItem{}, &ModelHardItem{}); err != nil {
+		t.Fatal(err)
+	}
+	flag := NewModel(&ModelConfig{Type: &ModelSoftFlagItem{}, SoftDelete: SoftDelete{Mode: SoftDeleteFlag}}, orm)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := flag.Create(ctx, &ModelSoftFlagItem{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var flagList []*ModelSoftFlagItem
+	sql, err := flag.Where("name", "a").ToSql(ctx, &flagList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql, "is_deleted") || strings.Contains(sql, "deleted_at") {
+		t.Errorf("unexpected soft delete column in %s", sql)
+	}
+	names := func(s *Scope) []string {
+		var list []*ModelSoftFlagItem
+		if err := s.OrderAsc("id").Find(ctx, &list); err != nil {
+			t.Fatal(err)
+		}
+		var res []string
+		for _, v := range list {
+			res = append(res, v.Name)
+		}
+		return res
+	}
+	if res, err := flag.Where("name", "IN", []string{"a", "b"}).Delete(ctx); err != nil || res.RowsAffected != 2 {
+		t.Fatalf("unexpected delete result %v %v", res, err)
+	}
+	if got := names(flag.NewScope()); len(got) != 1 || got[0] != "c" {
+		t.Errorf("unexpected alive rows %v", got)
+	}
+	if got := names(flag.OnlyTrashed()); len(got) != 2 {
+		t.Errorf("unexpected trashed rows %v", got)
+	}
+	if res, err := flag.Where("name", "a").Restore(ctx); err != nil || res.RowsAffected != 1 {
+		t.Errorf("unexpected restore result %v %v", res, err)
+	}
+	if res, err := flag.OnlyTrashed().ForceDelete(ctx); err != nil || res.RowsAffected != 1 {
+		t.Errorf("unexpected force delete result %v %v", res, err)
+	}
+	if got := names(flag.WithTrash()); len(got) != 2 || got[0] != "a" || got[1] != "c" {
+		t.Errorf("unexpected rows %v", got)
+	}
+
+	hard := NewModel(&ModelConfig{Type: &ModelHardItem{}, SoftDelete: SoftDelete{Mode: SoftDeleteNone}}, orm)
+	if err := hard.Create(ctx, &ModelHardItem{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := hard.Where("name", "a").Delete(ctx); err != nil || res.RowsAffected != 1 {
+		t.Errorf("unexpected delete result %v %v", res, err)
+	}
+	var rest []*ModelHardItem
+	if err := hard.Unscoped().Find(ctx, &rest); err != nil || len(rest) != 0 {
+		t.Errorf("expected no rows, got %d %v", len(rest), err)
+	}
+	if _, err := hard.Where("name", "a").Restore(ctx); err == nil {
+		t.Errorf("expected restore error without soft delete column")
+	}
+}
+
+type ModelStampItem struct {
+	Id         int32  `json:"id"`
+	Code       string `json:"code" gorm:"uniqueIndex"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+	DeletedAt  int32  `json:"deleted_at"`
+}
+
+func TestTimestamps(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelStampItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelStampItem{}, Timestamps: Timestamps{
+		CreatedColumn: "create_time",
+		UpdatedColumn: "update_time",
+		Unit:          TimestampMilli,
+	}}, orm)
+	start := time.Now().UnixMilli()
+	obj := &ModelStampItem{Code: "a"}
+	if err := item.Create(ctx, obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.CreateTime < start || obj.UpdateTime != obj.CreateTime {
+		t.Errorf("unexpected stamps %v", obj)
+	}
+	if _, err := item.Where("code", "a").Update(ctx, map[string]interface{}{"update_time": 1}); err != nil {
+		t.Fatal(err)
+	}
+	var got ModelStampItem
+	if err := item.Where("code", "a").First(ctx, &got); err != nil || got.UpdateTime != 1 || got.CreateTime != obj.CreateTime {
+		t.Errorf("unexpected row %v %v", got, err)
+	}
+	if _, err := item.Where("code", "a").Update(ctx, map[string]interface{}{"code": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := item.Where("code", "a").First(ctx, &got); err != nil || got.UpdateTime < start {
+		t.Errorf("expected update_time stamped, got %v %v", got, err)
+	}
+
+	skipped := &ModelStampItem{Code: "b"}
+	if err := item.NewScope().SkipTimestamps().Create(ctx, skipped); err != nil {
+		t.Fatal(err)
+	}
+	if skipped.CreateTime != 0 || skipped.UpdateTime != 0 {
+		t.Errorf("expected no stamps, got %v", skipped)
+	}
+	if _, err := item.Upsert(ctx, &ModelStampItem{Code: "b"}, []string{"code"}, []string{"code"}); err != nil {
+		t.Fatal(err)
+	}
+	var b ModelStampItem
+	if err := item.Where("code", "b").First(ctx, &b); err != nil || b.UpdateTime < start || b.CreateTime != 0 {
+		t.Errorf("expected only update_time stamped by upsert, got %v %v", b, err)
+	}
+}
+
+type ModelAutoTimeItem struct {
+	Id        int32  `json:"id"`
+	Code      string `json:"code"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestSkipTimestampsAutoTime(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelAutoTimeItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelAutoTimeItem{}}, orm)
+	get := func(code string) ModelAutoTimeItem {
+		var got ModelAutoTimeItem
+		if err := item.Where("code", code).First(ctx, &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// gorm 自己给 CreatedAt/UpdatedAt 补时间的字段也不写
+	if err := item.NewScope().SkipTimestamps().Create(ctx, &ModelAutoTimeItem{Code: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("a"); got.CreatedAt != 0 || got.UpdatedAt != 0 {
+		t.Errorf("expected no stamps, got %+v", got)
+	}
+	if _, err := item.NewScope().SkipTimestamps().CreateInBatches(ctx, []*ModelAutoTimeItem{{Code: "b"}, {Code: "c"}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("c"); got.CreatedAt != 0 || got.UpdatedAt != 0 {
+		t.Errorf("expected no stamps in batch, got %+v", got)
+	}
+	if err := item.NewScope().SkipTimestamps().Create(ctx, &ModelAutoTimeItem{Code: "d", CreatedAt: 7, UpdatedAt: 8}); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("d"); got.CreatedAt != 7 || got.UpdatedAt != 8 {
+		t.Errorf("expected explicit stamps kept, got %+v", got)
+	}
+
+	if _, err := item.Where("code", "a").SkipTimestamps().Update(ctx, map[string]interface{}{"code": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("a"); got.UpdatedAt != 0 {
+		t.Errorf("expected updated_at untouched by update, got %+v", got)
+	}
+	d := get("d")
+	if err := item.NewScope().SkipTimestamps().Save(ctx, &d); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("d"); got.CreatedAt != 7 || got.UpdatedAt != 8 {
+		t.Errorf("expected updated_at untouched by save, got %+v", got)
+	}
+
+	if _, err := item.Where("code", "a").Update(ctx, map[string]interface{}{"code": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("a"); got.UpdatedAt == 0 {
+		t.Errorf("expected updated_at stamped without SkipTimestamps, got %+v", got)
+	}
+}
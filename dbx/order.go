@@ -0,0 +1,233 @@
+package dbx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidOrder 排序字段不在模型中，或 SortBy 的写法不正确
+var ErrInvalidOrder = errors.New("invalid order")
+
+// nullsOrder NULL 值的排序位置
+type nullsOrder int
+
+const (
+	nullsDefault nullsOrder = iota
+	nullsFirst
+	nullsLast
+)
+
+// orderTerm 一个排序项，field 为字段名，expr 非空时为 sql 表达式，自带方向
+type orderTerm struct {
+	field string
+	expr  string
+	args  []interface{}
+	desc  bool
+	nulls nullsOrder
+	// strict 只能是模型的字段或 Select 的别名，SortBy 用
+	strict bool
+	// selectAlias field 是 Select 的别名，不加表的别名
+	selectAlias bool
+}
+
+func (s *Scope) addOrder(desc bool, fields ...string) *Scope {
+	for _, v := range fields {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				s.orders = append(s.orders, orderTerm{field: f, desc: desc})
+			}
+		}
+	}
+	return s
+}
+
+// OrderAsc 按 fields 升序排序，可以多次调用，每个字段有自己的方向，如 OrderDesc("level").OrderAsc("id")。
+// 字段需要在模型中（或是 Select 的别名、带表名的字段），否则查询返回 ErrInvalidOrder；不是字段名时作为表达式原样使用
+func (s *Scope) OrderAsc(fields ...string) *Scope {
+	return s.addOrder(false, fields...)
+}
+
+// OrderDesc 按 fields 降序排序，见 OrderAsc
+func (s *Scope) OrderDesc(fields ...string) *Scope {
+	return s.addOrder(true, fields...)
+}
+
+func (s *Scope) ResetOrderAsc(fields ...string) *Scope {
+	s.orders = nil
+	return s.addOrder(false, fields...)
+}
+
+func (s *Scope) ResetOrderDesc(fields ...string) *Scope {
+	s.orders = nil
+	return s.addOrder(true, fields...)
+}
+
+// OrderExpr 按 sql 表达式排序，方向写在表达式中，如 OrderExpr("ABS(score - ?) ASC", 60)，不做字段检查
+func (s *Scope) OrderExpr(sql string, args ...interface{}) *Scope {
+	s.orders = append(s.orders, orderTerm{expr: sql, args: args})
+	return s
+}
+
+// OrderByField 按 values 的顺序排序，相当于 mysql 的 ORDER BY FIELD(field, values...)，
+// 不在 values 中的行排在最后，各方言都可用
+func (s *Scope) OrderByField(field string, values ...interface{}) *Scope {
+	if len(values) == 0 {
+		return s
+	}
+	s.orders = append(s.orders, orderTerm{field: field, args: values})
+	return s
+}
+
+// NullsFirst 最后一个排序字段的 NULL 排在最前面
+func (s *Scope) NullsFirst() *Scope {
+	return s.setNulls(nullsFirst)
+}
+
+// NullsLast 最后一个排序字段的 NULL 排在最后面
+func (s *Scope) NullsLast() *Scope {
+	return s.setNulls(nullsLast)
+}
+
+func (s *Scope) setNulls(n nullsOrder) *Scope {
+	if len(s.orders) > 0 && s.orders[len(s.orders)-1].expr == "" {
+		s.orders[len(s.orders)-1].nulls = n
+	}
+	return s
+}
+
+// SortBy 按客户端传入的排序串排序，逗号分隔，字段前加 - 为降序、+ 或不加为升序，如 "-created_at,id"。
+// 字段按模型的字段名或列名匹配，不在模型中时查询返回 ErrInvalidOrder，可以直接使用外部输入
+func (s *Scope) SortBy(spec string) *Scope {
+	for _, f := range strings.Split(spec, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		desc := false
+		switch f[0] {
+		case '-':
+			desc = true
+			f = f[1:]
+		case '+':
+			f = f[1:]
+		}
+		s.orders = append(s.orders, orderTerm{field: f, desc: desc, strict: true})
+	}
+	return s
+}
+
+// isExprField 不是字段名的排序项作为表达式原样使用
+func isExprField(field string) bool {
+	return getFirstInvalidFieldNameCharIndex(strings.ReplaceAll(field, "`", "")) >= 0
+}
+
+// orderFields 检查排序字段并换成列名，aliases 为 Select 之外允许的别名
+func (s *Scope) orderFields(aliases ...string) ([]orderTerm, error) {
+	if len(s.orders) == 0 {
+		return nil, nil
+	}
+	sch, err := parseSchema(s.m.getModel())
+	if err != nil {
+		return nil, err
+	}
+	allowed := selectAliases(s.selects)
+	for _, v := range aliases {
+		allowed[v] = true
+	}
+	terms := make([]orderTerm, 0, len(s.orders))
+	for _, t := range s.orders {
+		if t.expr != "" {
+			terms = append(terms, t)
+			continue
+		}
+		name := strings.ReplaceAll(t.field, "`", "")
+		switch {
+		case t.strict && (name == "" || isExprField(name) || strings.IndexByte(name, '.') >= 0):
+			return nil, fmt.Errorf("%w: %q", ErrInvalidOrder, t.field)
+		case allowed[name]:
+			t.selectAlias = true
+		case !t.strict && (isExprField(name) || strings.IndexByte(name, '.') >= 0):
+			// 表达式和带表名的字段不检查
+		default:
+			f := sch.LookUpField(name)
+			if f == nil || f.DBName == "" {
+				return nil, fmt.Errorf("%w: %s not found in %s", ErrInvalidOrder, name, s.GetTableName())
+			}
+			t.field = f.DBName
+		}
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+// selectAliases Select 中 "expr AS alias" 的别名
+func selectAliases(selects []string) map[string]bool {
+	res := map[string]bool{}
+	for _, v := range selects {
+		if idx := strings.LastIndex(strings.ToUpper(v), " AS "); idx >= 0 {
+			res[strings.Trim(strings.TrimSpace(v[idx+4:]), "`")] = true
+		}
+	}
+	return res
+}
+
+// renderOrders 把排序项渲染成 ORDER BY 的各项和参数，alias 非空时字段加上表的别名
+func renderOrders(terms []orderTerm, alias string) ([]string, []interface{}) {
+	var orders []string
+	var args []interface{}
+	for _, t := range terms {
+		if t.expr != "" {
+			orders = append(orders, t.expr)
+			args = append(args, t.args...)
+			continue
+		}
+		col := t.field
+		if !isExprField(col) {
+			col = quoteFieldName(strings.ReplaceAll(col, "`", ""))
+			if alias != "" && !t.selectAlias {
+				col = qualifyColumn(t.field, alias)
+			}
+		}
+		switch t.nulls {
+		case nullsFirst:
+			orders = append(orders, col+" IS NULL DESC")
+		case nullsLast:
+			orders = append(orders, col+" IS NULL ASC")
+		}
+		if len(t.args) > 0 {
+			// OrderByField
+			var b strings.Builder
+			b.WriteString("CASE " + col)
+			for i, v := range t.args {
+				b.WriteString(fmt.Sprintf(" WHEN ? THEN %d", i))
+				args = append(args, v)
+			}
+			b.WriteString(fmt.Sprintf(" ELSE %d END", len(t.args)))
+			orders = append(orders, b.String())
+			continue
+		}
+		dir := "ASC"
+		if t.desc {
+			dir = "DESC"
+		}
+		orders = append(orders, col+" "+dir)
+	}
+	return orders, args
+}
+
+// orderBy 查询用的排序和参数
+func (s *Scope) orderBy(aliases ...string) ([]string, []interface{}, error) {
+	if err := s.condErr(); err != nil {
+		return nil, nil, err
+	}
+	terms, err := s.orderFields(aliases...)
+	if err != nil {
+		return nil, nil, err
+	}
+	orders, args := renderOrders(terms, s.qualifier())
+	if len(orders) == 0 {
+		return nil, nil, nil
+	}
+	return []string{strings.Join(orders, ",")}, args, nil
+}
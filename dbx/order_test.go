@@ -0,0 +1,87 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type ModelOrderItem struct {
+	Id        int32  `json:"id"`
+	Level     int32  `json:"level"`
+	Name      string `json:"name"`
+	Score     *int32 `json:"score"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestOrder(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelOrderItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelOrderItem{}}, orm)
+	score := func(v int32) *int32 { return &v }
+	list := []*ModelOrderItem{
+		{Level: 1, Name: "a", Score: score(50)},
+		{Level: 2, Name: "b"},
+		{Level: 2, Name: "c", Score: score(70)},
+		{Level: 1, Name: "d", Score: score(90)},
+	}
+	if _, err := item.NewScope().CreateInBatches(ctx, list, 0); err != nil {
+		t.Fatal(err)
+	}
+	names := func(s *Scope) string {
+		t.Helper()
+		var rows []*ModelOrderItem
+		if err := s.Find(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		var res string
+		for _, v := range rows {
+			res += v.Name
+		}
+		return res
+	}
+	cases := []struct {
+		name string
+		s    *Scope
+		want string
+	}{
+		{"mixed", item.NewScope().OrderDesc("level").OrderAsc("name"), "bcad"},
+		{"sort spec", item.NewScope().SortBy("-level, +name"), "bcad"},
+		{"field", item.NewScope().OrderByField("name", "c", "a").OrderAsc("id"), "cabd"},
+		{"nulls first", item.NewScope().OrderDesc("score").NullsFirst(), "bdca"},
+		{"nulls last", item.NewScope().OrderAsc("score").NullsLast(), "acdb"},
+		{"expr", item.NewScope().OrderExpr("ABS(COALESCE(score, 0) - ?) ASC", 65), "cadb"},
+	}
+	for _, c := range cases {
+		if got := names(c.s); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+
+	var rows []*ModelOrderItem
+	for _, spec := range []string{"-unknown", "name;drop", "t.name"} {
+		if err := item.NewScope().SortBy(spec).Find(ctx, &rows); !errors.Is(err, ErrInvalidOrder) {
+			t.Errorf("%s: expected ErrInvalidOrder, got %v", spec, err)
+		}
+	}
+	if err := item.NewScope().OrderAsc("missing").Find(ctx, &rows); !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("expected ErrInvalidOrder, got %v", err)
+	}
+
+	page, err := item.NewScope().OrderDesc("level").OrderAsc("name").SetLimit(2).FindByCursor(ctx, "", &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Name != "b" || rows[1].Name != "c" {
+		t.Fatalf("unexpected first page %+v", rows)
+	}
+	rows = nil
+	if _, err = item.NewScope().OrderDesc("level").OrderAsc("name").SetLimit(2).FindByCursor(ctx, page.NextCursor, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Name != "a" || rows[1].Name != "d" {
+		t.Errorf("unexpected second page %+v", rows)
+	}
+}
@@ -2,22 +2,30 @@ package dbx
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/cylScripter/chest/log"
 	"github.com/cylScripter/chest/utils"
 	"github.com/cylScripter/openapi/base"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"reflect"
 	"strings"
 	"time"
 )
 
 const DefaultLimit = 2000
 
+// DefaultBatchSize CreateInBatches 默认每批插入的条数
+const DefaultBatchSize = 500
+
 type DbProxy interface {
 	First(ctx context.Context, req *WhereReq, dest interface{}) error
 	Find(ctx context.Context, req *WhereReq, dest interface{}) error
 	Create(ctx context.Context, req *CreateReq, dest interface{}) error
+	CreateInBatches(ctx context.Context, req *CreateReq, dest interface{}) (CreateResult, error)
+	Upsert(ctx context.Context, req *CreateReq, dest interface{}) (UpdateOrCreateResult, error)
 	ToSql(ctx context.Context, req *WhereReq, dest interface{}) (string, error)
 	FindPaginate(ctx context.Context, req *WhereReq, dest interface{}) (*base.Paginate, error)
 	Count(ctx context.Context, req *WhereReq, dest interface{}) (int64, error)
@@ -25,6 +33,8 @@ type DbProxy interface {
 	AutoMigrate(dest ...interface{}) error
 	Update(ctx context.Context, req *WhereReq, dest interface{}, values map[string]interface{}) (UpdateResult, error)
 	Save(ctx context.Context, req *WhereReq, dest interface{}) error
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+	Rows(ctx context.Context, req *WhereReq, dest interface{}) (*Rows, error)
 }
 
 type DbConfig struct {
@@ -35,42 +45,184 @@ type DbConfig struct {
 	Ip           string
 	Port         int
 	MaxIdleCoins int // 最大空闲连接数
+	// Cache 查询缓存使用的 redis（*redisgroup.RedisGroup），为空时 Scope.EnableCache 不生效
+	Cache       QueryCache
+	CacheExpire time.Duration // 查询缓存过期时间，默认 DefaultCacheExpire
+	// Replicas 从库，Find/First/Count/FindPaginate 按 ReplicaPolicy 分到从库，写操作和事务始终走主库
+	Replicas            []ReplicaConfig
+	ReplicaPolicy       ReplicaPolicy // 默认 ReplicaRoundRobin
+	HealthCheckInterval time.Duration // 从库健康检查间隔，默认 DefaultHealthCheckInterval
+	// SlowThreshold 超过这个耗时的语句按 Warn 打印，默认 DefaultSlowThreshold，小于 0 时不检测
+	SlowThreshold time.Duration
+	// LogSqlValues 日志中的语句代入参数值，参数可能包含密码等敏感信息，默认只打印占位符和参数个数
+	LogSqlValues bool
+	// StatementTimeout 每条语句默认的超时时间，超时返回 ErrTimeout，0 时不限制，Scope.Timeout 可以覆盖
+	StatementTimeout time.Duration
 }
 
 type Db struct {
 	config DbConfig
 	db     *gorm.DB
+	// schema 非空时表名带上库名前缀，Registry 中与其他库共用连接的 Db 会设置
+	schema   string
+	replicas *replicaSet
+	dialect  Dialect
 }
 
-func (p *Db) GetModel(tableName string, dest interface{}) *gorm.DB {
-	query := p.db
-	if tableName != "" {
-		query = query.Table(tableName)
+// Dialect 返回 DbConfig.DbType 对应的方言
+func (p *Db) Dialect() Dialect {
+	return p.dialect
+}
+
+// where 把条件加到 query 上，条件中反引号引用的标识符按方言转换
+func (p *Db) where(query *gorm.DB, conds []Expr) *gorm.DB {
+	for _, cond := range conds {
+		query = query.Where(p.dialect.QuoteIdentifiers(cond.Sql), cond.Args...)
+	}
+	return query
+}
+
+// group 加上 GROUP BY 和 HAVING
+func (p *Db) group(query *gorm.DB, req *WhereReq) *gorm.DB {
+	if !req.needGroup {
+		return query
+	}
+	for _, group := range req.Groups {
+		query = query.Group(p.dialect.QuoteIdentifiers(group))
+	}
+	for _, cond := range req.Having {
+		if cond.Sql != "" {
+			query = query.Having(p.dialect.QuoteIdentifiers(cond.Sql), cond.Args...)
+		}
+	}
+	return query
+}
+
+// order 加上 ORDER BY，Orders 中有 ? 时用 OrderArgs 作为参数
+func (p *Db) order(query *gorm.DB, req *WhereReq) *gorm.DB {
+	if len(req.OrderArgs) > 0 {
+		return query.Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  p.dialect.QuoteIdentifiers(strings.Join(req.Orders, ",")),
+			Vars: req.OrderArgs,
+		}})
+	}
+	for _, order := range req.Orders {
+		query = query.Order(p.dialect.QuoteIdentifiers(order))
+	}
+	return query
+}
+
+// countGroups 分组查询的组数，在子查询外计数，HAVING 可以引用 Select 的别名
+func (p *Db) countGroups(query *gorm.DB, req *WhereReq) (int64, error) {
+	sub := query.Session(&gorm.Session{})
+	if len(req.Selects) > 0 {
+		sub = sub.Select(p.quoteAll(req.Selects))
 	} else {
-		modelType := strings.ReplaceAll(fmt.Sprintf("%T", dest), "[]", "")
-		query = query.Table(utils.CamelToSnake(modelType))
+		sub = sub.Select(p.quoteAll(req.Groups))
+	}
+	var n int64
+	err := query.Session(&gorm.Session{NewDB: true}).Table("(?) AS grouped", sub).Count(&n).Error
+	return n, err
+}
+
+// quoteAll 把字段列表中的反引号转换成方言的写法
+func (p *Db) quoteAll(list []string) []string {
+	res := make([]string, 0, len(list))
+	for _, v := range list {
+		res = append(res, p.dialect.QuoteIdentifiers(v))
+	}
+	return res
+}
+
+// from 查询的主表（带别名）和 JOIN
+func (p *Db) from(query *gorm.DB, req *WhereReq, dest interface{}) *gorm.DB {
+	table := p.tableName(req.TableName, dest)
+	if req.Alias != "" && req.Alias != table {
+		// 别名不加引号，gorm 才能识别出来用于 First 的主键排序
+		table = fmt.Sprintf("%s AS %s", p.dialect.QuoteIdentifiers(quoteFieldName(table)), req.Alias)
+	}
+	query = query.Table(table)
+	for _, j := range req.Joins {
+		query = query.Joins(p.dialect.QuoteIdentifiers(j.Sql), j.Args...)
 	}
 	return query
 }
 
+func (p *Db) GetModel(tableName string, dest interface{}) *gorm.DB {
+	return p.table(context.Background(), tableName, dest)
+}
+
+// table 与 GetModel 相同，但 ctx 中带有事务时使用事务句柄
+func (p *Db) table(ctx context.Context, tableName string, dest interface{}) *gorm.DB {
+	return p.session(ctx).Table(p.tableName(tableName, dest))
+}
+
+// tableName tableName 为空时由 dest 的类型推导表名
+func (p *Db) tableName(tableName string, dest interface{}) string {
+	if tableName == "" {
+		modelType := strings.ReplaceAll(fmt.Sprintf("%T", dest), "[]", "")
+		tableName = utils.CamelToSnake(modelType)
+	}
+	if p.schema != "" && !strings.Contains(tableName, ".") {
+		tableName = p.schema + "." + tableName
+	}
+	return tableName
+}
+
 func NewDb(cfg DbConfig) (*Db, error) {
-	dns := fmt.Sprintf("%s:%s@tcp(%v:%v)/%s?charset=utf8&parseTime=True&loc=Local", cfg.User, cfg.Password, cfg.Ip, cfg.Port, cfg.DbName)
-	db, err := gorm.Open(mysql.New(mysql.Config{
-		DSN:                       dns,   // DSN data source name
-		DefaultStringSize:         256,   // string 类型字段的默认长度
-		DisableDatetimePrecision:  true,  // 禁用 datetime 精度，MySQL 5.6 之前的数据库不支持
-		DontSupportRenameIndex:    true,  // 重命名索引时采用删除并新建的方式，MySQL 5.7 之前的数据库和 MariaDB 不支持重命名索引
-		DontSupportRenameColumn:   true,  // 用 `change` 重命名列，MySQL 8 之前的数据库和 MariaDB 不支持重命名列
-		SkipInitializeWithVersion: false, // 根据当前 MySQL 版本自动配置
-	}), &gorm.Config{})
+	d, err := GetDialect(cfg.DbType)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openDb(d.Dialector(d.Dsn(cfg.User, cfg.Password, cfg.Ip, cfg.Port, cfg.DbName)), cfg, false)
 	if err != nil {
 		log.Errorf("NewDb failed, err:%v", err)
 		return nil, err
 	}
-	return &Db{
-		config: cfg,
-		db:     db,
-	}, nil
+	res := &Db{
+		config:  cfg,
+		db:      db,
+		dialect: d,
+	}
+	if len(cfg.Replicas) > 0 {
+		res.replicas = newReplicaSet(d, cfg)
+	}
+	return res, nil
+}
+
+// Close 停止从库健康检查并关闭主从库连接
+func (p *Db) Close() error {
+	if p.replicas != nil {
+		p.replicas.close()
+	}
+	sqlDb, err := p.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDb.Close()
+}
+
+// openDb 打开连接，语句由 registerSqlLog 打印，不使用 gorm 自带的日志。
+// lazy 时不 ping，连接在第一次执行语句时才建立
+func openDb(dialector gorm.Dialector, cfg DbConfig, lazy bool) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Discard, DisableAutomaticPing: lazy})
+	if err != nil {
+		return nil, err
+	}
+	slow := cfg.SlowThreshold
+	if slow == 0 {
+		slow = DefaultSlowThreshold
+	}
+	if err = registerSqlLog(db, slow, cfg.LogSqlValues); err == nil {
+		err = registerTimeout(db, cfg.StatementTimeout)
+	}
+	if err != nil {
+		if sqlDb, e := db.DB(); e == nil {
+			_ = sqlDb.Close()
+		}
+		return nil, err
+	}
+	return db, nil
 }
 
 type WhereReq struct {
@@ -79,16 +231,60 @@ type WhereReq struct {
 	Selects   []string
 	Groups    []string
 	Orders    []string
-	Cond      []string
+	Cond      []Expr
 	needGroup bool
-	Unscoped  bool
-	TableName string
+	// Unscoped 包含已软删除的行
+	Unscoped bool
+	// OnlyTrashed 只包含已软删除的行
+	OnlyTrashed bool
+	// SoftDelete 表的软删除策略
+	SoftDelete SoftDelete
+	// HardDelete Delete 时物理删除
+	HardDelete bool
+	TableName  string
+	// Alias 主表别名，与 Joins 一起使用
+	Alias string
+	// Joins 查询时的 JOIN 子句，只用于读操作
+	Joins []Expr
+	// Having 分组后的过滤条件，只在有分组时生效
+	Having []Expr
+	// OrderArgs Orders 中 ? 对应的参数
+	OrderArgs []interface{}
+	// Lock First/Find 的行锁，只能在事务中使用
+	Lock *Lock
+	// Db 逻辑库名，Registry 按它路由，单个 Db 忽略
+	Db string
+	// EnableCache Find/First/Count 的结果缓存到 DbConfig.Cache
+	EnableCache bool
+	// UseMaster 读操作也走主库
+	UseMaster bool
+	// CountStrategy FindPaginate 计算总数的方式
+	CountStrategy CountStrategy
+	// Omit Save 不写入的列
+	Omit []string
+	// SkipAutoTime Update/Save 不让 gorm 自动写入 autoUpdateTime 列
+	SkipAutoTime bool
 }
 
 type CreateReq struct {
 	TableName string
+	Db        string
 	Selects   []string
 	Omit      []string
+	// IgnoreConflict 跳过唯一键冲突的行，mysql 为 INSERT IGNORE，其他方言为 ON CONFLICT DO NOTHING
+	IgnoreConflict bool
+	// BatchSize CreateInBatches 每批的条数，默认 DefaultBatchSize
+	BatchSize int
+	// ConflictColumns Upsert 判断冲突的唯一键列，mysql 按表上的唯一索引判断，可以不填
+	ConflictColumns []string
+	// UpdateColumns Upsert 冲突时更新的列，为空时保留已有的行
+	UpdateColumns []string
+}
+
+// CreateResult 批量插入的结果，Skipped 为 IgnoreConflict 时因冲突跳过的行数
+type CreateResult struct {
+	Inserted uint64
+	Skipped  uint64
 }
 
 type DeleteResult struct {
@@ -101,7 +297,22 @@ type UpdateResult struct {
 type SelectResult struct {
 	Total      uint32
 	NextOffset uint32
+	HasMore    bool
 }
+
+// CountStrategy FindPaginate 计算总数的方式
+type CountStrategy int
+
+const (
+	// CountExact 用与分页查询相同的条件和分组 COUNT
+	CountExact CountStrategy = iota
+	// CountSkip 不 COUNT，多查一条判断是否还有下一页
+	CountSkip
+	// CountEstimate 按执行计划估算，方言不支持时退化为 CountExact
+	CountEstimate
+)
+
+// UpdateOrCreateResult Upsert 的结果，RowsAffected 为插入或更新了的行数，已有的行没有变化时为 0
 type UpdateOrCreateResult struct {
 	Created      bool
 	RowsAffected uint64
@@ -111,10 +322,22 @@ type FirstOrCreateResult struct {
 }
 
 func (p *Db) Find(ctx context.Context, req *WhereReq, dest interface{}) error {
-	query := p.GetModel(req.TableName, dest)
-	if !req.Unscoped {
-		query = query.Scopes(ScopeGetIsDel())
+	if err := p.checkLock(ctx, req); err != nil {
+		return err
 	}
+	return p.withCache(ctx, "find", req, dest, dest, func(req *WhereReq) error {
+		return p.find(ctx, req, dest)
+	})
+}
+
+func (p *Db) find(ctx context.Context, req *WhereReq, dest interface{}) error {
+	return p.findQuery(ctx, req, dest).Find(dest).Error
+}
+
+// findQuery Find 和 Rows 共用的查询
+func (p *Db) findQuery(ctx context.Context, req *WhereReq, dest interface{}) *gorm.DB {
+	query := p.readTable(ctx, req, dest)
+	query = p.where(query, req.softDeleteCond())
 	if req.Limit > 0 {
 		query = query.Limit(int(req.Limit))
 	}
@@ -122,99 +345,213 @@ func (p *Db) Find(ctx context.Context, req *WhereReq, dest interface{}) error {
 		query = query.Offset(int(req.Offset))
 	}
 	if len(req.Selects) > 0 {
-		query = query.Select(req.Selects)
+		query = query.Select(p.quoteAll(req.Selects))
 	}
 	// where
-	for _, cond := range req.Cond {
-		query = query.Where(cond)
-	}
+	query = p.where(query, req.Cond)
 	// group
-	if req.needGroup {
-		log.Infof("groups:%v", req.Groups)
-		for _, group := range req.Groups {
-			query = query.Group(group)
-		}
-	}
-	for _, order := range req.Orders {
-		query = query.Order(order)
-	}
-
-	return query.Find(dest).Error
+	query = p.group(query, req)
+	query = p.order(query, req)
+	query = p.locking(query, req)
+	return query
 }
 
 func (p *Db) ToSql(ctx context.Context, req *WhereReq, dest interface{}) (string, error) {
-	sql := p.db.ToSQL(func(tx *gorm.DB) *gorm.DB {
-		query := tx
-		if req.TableName != "" {
-			query = query.Table(req.TableName)
-		} else {
-			modelType := strings.ReplaceAll(fmt.Sprintf("%T", dest), "[]", "")
-			query = query.Table(utils.CamelToSnake(modelType))
-		}
+	sql := p.session(ctx).ToSQL(func(tx *gorm.DB) *gorm.DB {
+		query := p.from(tx, req, dest)
 
-		if !req.Unscoped {
-			query = query.Scopes(ScopeGetIsDel())
-		}
-		for _, cond := range req.Cond {
-			query = query.Where(cond)
-		}
-		for _, order := range req.Orders {
-			query = query.Order(order)
-		}
+		query = p.where(query, req.softDeleteCond())
+		query = p.where(query, req.Cond)
+		query = p.order(query, req)
 		// group
-		if req.needGroup {
-			log.Infof("groups:%v", req.Groups)
-			for _, group := range req.Groups {
-				query = query.Group(group)
-			}
-		}
+		query = p.group(query, req)
 		if len(req.Selects) > 0 {
-			query = query.Select(req.Selects)
+			query = query.Select(p.quoteAll(req.Selects))
 		}
+		query = p.locking(query, req)
 		return query.Find(dest)
 	})
 	return sql, nil
 }
 
-func (p *Db) Create(ctx context.Context, req *CreateReq, dest interface{}) error {
-	query := p.GetModel(req.TableName, dest)
+func (p *Db) createQuery(ctx context.Context, req *CreateReq, dest interface{}) *gorm.DB {
+	query := p.table(ctx, req.TableName, dest)
 	if len(req.Omit) > 0 {
 		query = query.Omit(req.Omit...)
 	}
 	if len(req.Selects) > 0 {
-		query = query.Select(req.Selects)
+		query = query.Select(p.quoteAll(req.Selects))
+	}
+	if req.IgnoreConflict {
+		query = query.Clauses(p.dialect.Upsert(nil, nil))
 	}
-	return query.Create(dest).Error
+	return query
 }
 
-func (p *Db) First(ctx context.Context, req *WhereReq, dest interface{}) error {
-	query := p.GetModel(req.TableName, dest)
-	if !req.Unscoped {
-		query = query.Scopes(ScopeGetIsDel())
+func (p *Db) Create(ctx context.Context, req *CreateReq, dest interface{}) error {
+	err := p.createQuery(ctx, req, dest).Create(dest).Error
+	if err == nil {
+		p.invalidateCache(ctx, p.tableName(req.TableName, dest))
 	}
-	if len(req.Selects) > 0 {
-		query = query.Select(req.Selects)
+	return err
+}
+
+// Upsert 插入 dest，与已有的行冲突时更新 req.UpdateColumns。
+// mysql 由一条语句的影响行数区分插入和更新，postgres 由一条带 RETURNING 的语句判断是否为新行。
+// 其他方言（sqlite）一条语句无法区分，先用忽略冲突的插入判断是否为新行，再对已有的行执行带更新的 upsert，
+// 两条语句在同一个事务中执行；sqlite 的写事务独占整个库，两条语句之间不会有其他连接写入
+func (p *Db) Upsert(ctx context.Context, req *CreateReq, dest interface{}) (UpdateOrCreateResult, error) {
+	var res UpdateOrCreateResult
+	var err error
+	switch {
+	case len(req.UpdateColumns) == 0 || p.dialect.UpsertReportsCreated():
+		res, err = p.upsert(ctx, req, dest)
+	case p.dialect.UpsertCreatedExpr() != "":
+		res, err = p.upsertReturning(ctx, req, dest)
+	default:
+		err = p.Transaction(ctx, func(ctx context.Context) error {
+			var err error
+			res, err = p.upsertInTwoSteps(ctx, req, dest)
+			return err
+		})
 	}
-	// where
-	for _, cond := range req.Cond {
-		query = query.Where(cond)
+	if err != nil {
+		return res, err
 	}
-	// group
-	if req.needGroup {
-		for _, group := range req.Groups {
-			query = query.Group(group)
+	if res.RowsAffected > 0 {
+		p.invalidateCache(ctx, p.tableName(req.TableName, dest))
+	}
+	return res, nil
+}
+
+// upsert 执行一条 upsert，没有要更新的列时忽略冲突的行，影响行数为 1 时是新插入的行
+func (p *Db) upsert(ctx context.Context, req *CreateReq, dest interface{}) (UpdateOrCreateResult, error) {
+	var res UpdateOrCreateResult
+	result := p.createQuery(ctx, req, dest).Clauses(p.dialect.Upsert(req.ConflictColumns, req.UpdateColumns)).Create(dest)
+	if result.Error != nil {
+		return res, result.Error
+	}
+	res.Created = result.RowsAffected == 1
+	if result.RowsAffected > 0 {
+		res.RowsAffected = 1
+	}
+	return res, nil
+}
+
+// upsertInTwoSteps 先忽略冲突插入，没有插入时再执行带更新的 upsert，需要在事务中调用
+func (p *Db) upsertInTwoSteps(ctx context.Context, req *CreateReq, dest interface{}) (UpdateOrCreateResult, error) {
+	ignore := *req
+	ignore.UpdateColumns = nil
+	res, err := p.upsert(ctx, &ignore, dest)
+	if err != nil || res.Created {
+		return res, err
+	}
+	res, err = p.upsert(ctx, req, dest)
+	res.Created = false
+	return res, err
+}
+
+// upsertCreatedColumn upsertReturning 中标记新插入行的列名
+const upsertCreatedColumn = "dbx_upsert_created"
+
+// upsertReturningQuery 生成不执行的带更新的 upsert，RETURNING 方言判断新行的表达式和数据库生成的列
+func (p *Db) upsertReturningQuery(ctx context.Context, req *CreateReq, dest interface{}) (*gorm.DB, error) {
+	query := p.createQuery(ctx, req, dest)
+	if err := query.Statement.Parse(dest); err != nil {
+		return nil, err
+	}
+	returning := clause.Returning{Columns: []clause.Column{{
+		Name: p.dialect.UpsertCreatedExpr() + " AS " + p.dialect.Quote(upsertCreatedColumn),
+		Raw:  true,
+	}}}
+	for _, f := range query.Statement.Schema.FieldsWithDefaultDBValue {
+		returning.Columns = append(returning.Columns, clause.Column{Name: f.DBName})
+	}
+	query = query.Clauses(p.dialect.Upsert(req.ConflictColumns, req.UpdateColumns), returning).
+		Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true}).Create(dest)
+	return query, query.Error
+}
+
+// upsertReturning 一条带 RETURNING 的 upsert，由返回的标记判断是否为新插入的行，并回填数据库生成的列
+func (p *Db) upsertReturning(ctx context.Context, req *CreateReq, dest interface{}) (UpdateOrCreateResult, error) {
+	var res UpdateOrCreateResult
+	query, err := p.upsertReturningQuery(ctx, req, dest)
+	if err != nil {
+		return res, err
+	}
+	stmt := query.Statement
+	var rows []map[string]interface{}
+	// 生成的语句已经是方言的占位符，多余的参数按原值追加
+	if err = p.session(ctx).Raw(stmt.SQL.String(), stmt.Vars...).Find(&rows).Error; err != nil {
+		return res, err
+	}
+	if len(rows) == 0 {
+		return res, nil
+	}
+	res.RowsAffected = 1
+	res.Created, _ = rows[0][upsertCreatedColumn].(bool)
+	rv := reflect.Indirect(reflect.ValueOf(dest))
+	for _, f := range stmt.Schema.FieldsWithDefaultDBValue {
+		if v, ok := rows[0][f.DBName]; ok && v != nil {
+			if err = f.Set(ctx, rv, v); err != nil {
+				return res, err
+			}
 		}
 	}
-	for _, order := range req.Orders {
-		query = query.Order(order)
+	return res, nil
+}
+
+// CreateInBatches 每 req.BatchSize 条一条 INSERT 语句，多于一批时在同一个事务中执行
+func (p *Db) CreateInBatches(ctx context.Context, req *CreateReq, dest interface{}) (CreateResult, error) {
+	var res CreateResult
+	list := reflect.Indirect(reflect.ValueOf(dest))
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return res, fmt.Errorf("dest required slice, but got %T", dest)
+	}
+	if list.Len() == 0 {
+		return res, nil
+	}
+	batchSize := req.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	result := p.createQuery(ctx, req, dest).CreateInBatches(dest, batchSize)
+	if result.Error != nil {
+		return res, result.Error
+	}
+	res.Inserted = uint64(result.RowsAffected)
+	res.Skipped = uint64(list.Len()) - res.Inserted
+	p.invalidateCache(ctx, p.tableName(req.TableName, dest))
+	return res, nil
+}
+
+func (p *Db) First(ctx context.Context, req *WhereReq, dest interface{}) error {
+	if err := p.checkLock(ctx, req); err != nil {
+		return err
 	}
+	return p.withCache(ctx, "first", req, dest, dest, func(req *WhereReq) error {
+		return p.first(ctx, req, dest)
+	})
+}
+
+func (p *Db) first(ctx context.Context, req *WhereReq, dest interface{}) error {
+	query := p.readTable(ctx, req, dest)
+	query = p.where(query, req.softDeleteCond())
+	if len(req.Selects) > 0 {
+		query = query.Select(p.quoteAll(req.Selects))
+	}
+	// where
+	query = p.where(query, req.Cond)
+	// group
+	query = p.group(query, req)
+	query = p.order(query, req)
+	query = p.locking(query, req)
 	return query.First(dest).Error
 }
 
 func (p *Db) AutoMigrate(dest ...interface{}) error {
 	for _, v := range dest {
-		modelType := fmt.Sprintf("%T", v)
-		err := p.db.Table(utils.CamelToSnake(modelType)).AutoMigrate(v)
+		err := p.db.Table(p.tableName("", v)).AutoMigrate(v)
 		if err != nil {
 			log.Errorf("AutoMigrate failed, err:%v", err)
 			return err
@@ -223,6 +560,8 @@ func (p *Db) AutoMigrate(dest ...interface{}) error {
 	return nil
 }
 
+// FindPaginate 按 WhereReq.CountStrategy 计算 Total，CountSkip 时 Total 只是下限，
+// 大于 Offset+本页条数说明还有下一页
 func (p *Db) FindPaginate(ctx context.Context, req *WhereReq, dest interface{}) (*base.Paginate, error) {
 	result, err := p.FindWithResult(ctx, req, dest)
 	return &base.Paginate{
@@ -234,8 +573,7 @@ func (p *Db) FindPaginate(ctx context.Context, req *WhereReq, dest interface{})
 
 func (p *Db) FindWithResult(ctx context.Context, req *WhereReq, dest interface{}) (SelectResult, error) {
 	var res SelectResult
-	var total int64
-	query := p.GetModel(req.TableName, dest)
+	query := p.readTable(ctx, req, dest)
 	var limit int
 	switch {
 	case req.Limit < 0:
@@ -245,45 +583,106 @@ func (p *Db) FindWithResult(ctx context.Context, req *WhereReq, dest interface{}
 	default:
 		limit = int(req.Limit)
 	}
-	if !req.Unscoped {
-		query = query.Scopes(ScopeGetIsDel())
+	query = p.where(query, req.softDeleteCond())
+	query = p.where(query, req.Cond)
+	// group
+	query = p.group(query, req)
+	// 总数与分页查询使用相同的条件和分组
+	total, err := p.paginateTotal(ctx, req, query)
+	if err != nil {
+		return res, err
 	}
-	query.Count(&total)
 	if limit > 0 {
-		query = query.Limit(int(req.Limit))
+		if req.CountStrategy == CountSkip {
+			// 多查一条判断后面是否还有数据
+			query = query.Limit(limit + 1)
+		} else {
+			query = query.Limit(limit)
+		}
 	}
 	if req.Offset > 0 {
 		query = query.Offset(int(req.Offset))
 	}
 	if len(req.Selects) > 0 {
-		query = query.Select(req.Selects)
-	}
-	for _, cond := range req.Cond {
-		query = query.Where(cond)
+		query = query.Select(p.quoteAll(req.Selects))
 	}
-	for _, order := range req.Orders {
-		query = query.Order(order)
+	query = p.order(query, req)
+	result := query.Find(dest)
+	if result.Error != nil {
+		return res, result.Error
+	}
+	n := 0
+	if v := reflect.Indirect(reflect.ValueOf(dest)); v.Kind() == reflect.Slice {
+		if req.CountStrategy == CountSkip && limit > 0 && v.Len() > limit {
+			res.HasMore = true
+			v.SetLen(limit)
+		}
+		n = v.Len()
 	}
-	// group
-	if req.needGroup {
-		for _, group := range req.Groups {
-			query = query.Group(group)
+	if req.CountStrategy == CountSkip {
+		total = int64(req.Offset) + int64(n)
+		if res.HasMore {
+			total++
 		}
+	} else {
+		res.HasMore = int64(req.Offset)+int64(n) < total
+	}
+	if res.HasMore {
+		res.NextOffset = req.Offset + uint32(n)
 	}
-	result := query.Find(dest)
 	res.Total = uint32(total)
-	return res, result.Error
+	return res, nil
+}
+
+// paginateTotal 按 req.CountStrategy 计算 query 的总行数，有分组时为组数，CountSkip 时返回 0，估算失败时退化为精确计数，超时时返回 ErrTimeout
+func (p *Db) paginateTotal(ctx context.Context, req *WhereReq, query *gorm.DB) (int64, error) {
+	var total int64
+	switch req.CountStrategy {
+	case CountSkip:
+		return 0, nil
+	case CountEstimate:
+		stmt := query.Session(&gorm.Session{DryRun: true}).Find(&[]map[string]interface{}{}).Statement
+		ectx, cancel := withStatementTimeout(ctx, p.config.StatementTimeout)
+		n, err := p.dialect.EstimateCount(ectx, stmt.ConnPool, stmt.SQL.String(), stmt.Vars)
+		err = wrapTimeout(ectx, err)
+		cancel()
+		if err == nil || errors.Is(err, ErrTimeout) {
+			return n, err
+		}
+		if !errors.Is(err, ErrEstimateUnsupported) {
+			log.Warnf("estimate count failed, fallback to exact count, err:%v", err)
+		}
+	}
+	if req.needGroup {
+		return p.countGroups(query, req)
+	}
+	err := query.Session(&gorm.Session{}).Count(&total).Error
+	return total, err
 }
 
 func (p *Db) Count(ctx context.Context, req *WhereReq, dest interface{}) (int64, error) {
-	query := p.GetModel(req.TableName, dest).Select("count(id) as count")
-	if !req.Unscoped {
-		query = query.Scopes(ScopeGetIsDel())
+	var count int64
+	err := p.withCache(ctx, "count", req, dest, &count, func(req *WhereReq) error {
+		var err error
+		count, err = p.count(ctx, req, dest)
+		return err
+	})
+	return count, err
+}
+
+func (p *Db) count(ctx context.Context, req *WhereReq, dest interface{}) (int64, error) {
+	query := p.readTable(ctx, req, dest)
+	query = p.where(query, req.softDeleteCond())
+	query = p.where(query, req.Cond)
+	if req.needGroup {
+		// 分组时返回组数
+		return p.countGroups(p.group(query, req), req)
 	}
 	type res struct {
 		Count int64 `json:"count"`
 	}
 	var result res
+	query = query.Select("count(*) as count")
 	if req.Limit > 0 {
 		query = query.Limit(int(req.Limit))
 	}
@@ -291,19 +690,13 @@ func (p *Db) Count(ctx context.Context, req *WhereReq, dest interface{}) (int64,
 	if req.Offset > 0 {
 		query = query.Offset(int(req.Offset))
 	}
-
-	for _, cond := range req.Cond {
-		query = query.Where(cond)
-	}
-	if req.needGroup {
-		for _, group := range req.Groups {
-			query = query.Group(group)
-		}
-	}
-	err := query.First(&result).Error
+	err := query.Take(&result).Error
 	return result.Count, err
 }
 
+// ScopeGetIsDel 过滤 deleted_at 不为 0 的行。
+//
+// Deprecated: 软删除按 ModelConfig.SoftDelete 配置，由 WhereReq.Unscoped/OnlyTrashed 控制
 func ScopeGetIsDel() func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		return db.Where("deleted_at = 0")
@@ -312,34 +705,53 @@ func ScopeGetIsDel() func(db *gorm.DB) *gorm.DB {
 
 func (p *Db) Delete(ctx context.Context, req *WhereReq, dest interface{}) (DeleteResult, error) {
 	var res DeleteResult
-	query := p.GetModel(req.TableName, dest)
-	if !req.Unscoped {
-		query = query.Scopes(ScopeGetIsDel())
-	}
-	for _, cond := range req.Cond {
-		query = query.Where(cond)
+	query := p.table(ctx, req.TableName, dest)
+	query = p.where(query, req.softDeleteCond())
+	query = p.where(query, req.Cond)
+	var result *gorm.DB
+	if req.HardDelete || req.SoftDelete.Mode == SoftDeleteNone {
+		result = query.Delete(dest)
+	} else {
+		result = query.Update(req.SoftDelete.column(), req.SoftDelete.deletedValue())
 	}
-	result := query.Update("deleted_at", time.Now().Unix())
 	res.RowsAffected = uint64(result.RowsAffected)
+	if result.Error == nil {
+		p.invalidateCache(ctx, p.tableName(req.TableName, dest))
+	}
 	return res, result.Error
 }
 
 func (p *Db) Update(ctx context.Context, req *WhereReq, dest interface{}, values map[string]interface{}) (UpdateResult, error) {
 	res := UpdateResult{}
-	query := p.GetModel(req.TableName, dest)
-	if !req.Unscoped {
-		query = query.Scopes(ScopeGetIsDel())
-	}
-	for _, cond := range req.Cond {
-		query = query.Where(cond)
+	query := p.table(ctx, req.TableName, dest)
+	query = p.where(query, req.softDeleteCond())
+	query = p.where(query, req.Cond)
+	var result *gorm.DB
+	if req.SkipAutoTime {
+		result = query.UpdateColumns(values)
+	} else {
+		result = query.Updates(values)
 	}
-	result := query.Updates(values)
 	res.Sql = result.Statement.SQL.String()
 	res.RowsAffected = uint64(result.RowsAffected)
-	return res, nil
+	if result.Error == nil {
+		p.invalidateCache(ctx, p.tableName(req.TableName, dest))
+	}
+	return res, result.Error
 }
 
 func (p *Db) Save(ctx context.Context, req *WhereReq, dest interface{}) error {
-	query := p.GetModel(req.TableName, dest)
-	return query.Save(dest).Error
+	query := p.table(ctx, req.TableName, dest)
+	if len(req.Omit) > 0 {
+		query = query.Omit(req.Omit...)
+	}
+	if req.SkipAutoTime {
+		// Save 按更新处理时 gorm 会把 autoUpdateTime 列改成当前时间，跳过 gorm 的钩子才能按原值写入
+		query = query.Session(&gorm.Session{SkipHooks: true})
+	}
+	err := query.Save(dest).Error
+	if err == nil {
+		p.invalidateCache(ctx, p.tableName(req.TableName, dest))
+	}
+	return err
 }
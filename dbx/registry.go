@@ -0,0 +1,276 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/cylScripter/openapi/base"
+)
+
+// Registry 按逻辑库名管理多个 Db，本身实现 DbProxy，
+// 每个请求按 WhereReq.Db / CreateReq.Db（即 ModelConfig.Db 或 Scope.UseDb）路由到对应的 Db，库名为空时走默认库。
+// 方言支持跨库访问（mysql）时，同一台服务器（DbType、地址、账号相同）上的多个库共用一个连接池，表名带上库名前缀，
+// 事务也可以跨这些库；不支持时（postgres、sqlite）每个库单独连接
+type Registry struct {
+	mu    sync.RWMutex
+	dbs   map[string]*Db
+	conns map[string]*Db
+	def   string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		dbs:   map[string]*Db{},
+		conns: map[string]*Db{},
+	}
+}
+
+// serverKey 可以共用连接的库的 key，方言不支持跨库访问时带上库名
+func serverKey(d Dialect, cfg DbConfig) string {
+	key := fmt.Sprintf("%s|%s:%s@%s:%d", d.Name(), cfg.User, cfg.Password, cfg.Ip, cfg.Port)
+	if !d.CrossDatabase() {
+		key += "/" + cfg.DbName
+	}
+	return key
+}
+
+// Register 以 name 注册一个库，第一个注册的库作为默认库。
+// 与已注册的库共用连接时，连接相关的设置（连接池、从库、日志、超时）要与建连接的库一致，不一致时返回错误
+func (r *Registry) Register(name string, cfg DbConfig) (*Db, error) {
+	d, err := GetDialect(cfg.DbType)
+	if err != nil {
+		return nil, err
+	}
+	key := serverKey(d, cfg)
+	r.mu.Lock()
+	db, err := r.reuse(name, key, cfg)
+	r.mu.Unlock()
+	if err != nil || db != nil {
+		return db, err
+	}
+	// 建连接时不持有锁，不阻塞其他库的注册和路由
+	conn, err := NewDb(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 建连接期间可能有同名的库或同一台服务器上的库注册了
+	if db, err = r.reuse(name, key, cfg); err != nil || db != nil {
+		_ = conn.Close()
+		return db, err
+	}
+	r.conns[key] = conn
+	r.add(name, conn)
+	return conn, nil
+}
+
+// reuse 检查 name 是否已注册，key 上已有连接时在它上面注册 name 对应的 Db，没有连接时返回 nil，调用方持有 r.mu
+func (r *Registry) reuse(name, key string, cfg DbConfig) (*Db, error) {
+	if _, ok := r.dbs[name]; ok {
+		return nil, fmt.Errorf("db %s already registered", name)
+	}
+	conn, ok := r.conns[key]
+	if !ok {
+		return nil, nil
+	}
+	if field := connConfigDiff(conn.config, cfg); field != "" {
+		return nil, fmt.Errorf("db %s shares connection with db %s but has different %s", name, conn.config.DbName, field)
+	}
+	db := &Db{
+		config:   cfg,
+		db:       conn.db,
+		replicas: conn.replicas,
+		dialect:  conn.dialect,
+	}
+	if cfg.DbName != conn.config.DbName {
+		db.schema = cfg.DbName
+	}
+	r.add(name, db)
+	return db, nil
+}
+
+// connConfigDiff 返回 a、b 中第一个不同的连接级设置，共用连接时只有建连接的库的设置生效
+func connConfigDiff(a, b DbConfig) string {
+	switch {
+	case a.MaxIdleCoins != b.MaxIdleCoins:
+		return "MaxIdleCoins"
+	case (len(a.Replicas) > 0 || len(b.Replicas) > 0) && !reflect.DeepEqual(a.Replicas, b.Replicas):
+		return "Replicas"
+	case a.ReplicaPolicy != b.ReplicaPolicy:
+		return "ReplicaPolicy"
+	case a.HealthCheckInterval != b.HealthCheckInterval:
+		return "HealthCheckInterval"
+	case a.SlowThreshold != b.SlowThreshold:
+		return "SlowThreshold"
+	case a.LogSqlValues != b.LogSqlValues:
+		return "LogSqlValues"
+	case a.StatementTimeout != b.StatementTimeout:
+		return "StatementTimeout"
+	}
+	return ""
+}
+
+// RegisterDb 以 name 注册一个已经创建好的 Db
+func (r *Registry) RegisterDb(name string, db *Db) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.dbs[name]; ok {
+		return fmt.Errorf("db %s already registered", name)
+	}
+	r.add(name, db)
+	return nil
+}
+
+func (r *Registry) add(name string, db *Db) {
+	r.dbs[name] = db
+	if r.def == "" {
+		r.def = name
+	}
+}
+
+// SetDefault 设置库名为空时使用的库
+func (r *Registry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.dbs[name]; !ok {
+		return fmt.Errorf("db %s not registered", name)
+	}
+	r.def = name
+	return nil
+}
+
+// Use 返回 name 对应的 Db，name 为空时返回默认库
+func (r *Registry) Use(name string) (*Db, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name == "" {
+		name = r.def
+	}
+	db, ok := r.dbs[name]
+	if !ok {
+		return nil, fmt.Errorf("db %s not registered", name)
+	}
+	return db, nil
+}
+
+func (r *Registry) First(ctx context.Context, req *WhereReq, dest interface{}) error {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return err
+	}
+	return db.First(ctx, req, dest)
+}
+
+func (r *Registry) Find(ctx context.Context, req *WhereReq, dest interface{}) error {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return err
+	}
+	return db.Find(ctx, req, dest)
+}
+
+func (r *Registry) Create(ctx context.Context, req *CreateReq, dest interface{}) error {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return err
+	}
+	return db.Create(ctx, req, dest)
+}
+
+func (r *Registry) CreateInBatches(ctx context.Context, req *CreateReq, dest interface{}) (CreateResult, error) {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return CreateResult{}, err
+	}
+	return db.CreateInBatches(ctx, req, dest)
+}
+
+func (r *Registry) Upsert(ctx context.Context, req *CreateReq, dest interface{}) (UpdateOrCreateResult, error) {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return UpdateOrCreateResult{}, err
+	}
+	return db.Upsert(ctx, req, dest)
+}
+
+func (r *Registry) ToSql(ctx context.Context, req *WhereReq, dest interface{}) (string, error) {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return "", err
+	}
+	return db.ToSql(ctx, req, dest)
+}
+
+func (r *Registry) FindPaginate(ctx context.Context, req *WhereReq, dest interface{}) (*base.Paginate, error) {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return nil, err
+	}
+	return db.FindPaginate(ctx, req, dest)
+}
+
+func (r *Registry) Count(ctx context.Context, req *WhereReq, dest interface{}) (int64, error) {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return 0, err
+	}
+	return db.Count(ctx, req, dest)
+}
+
+func (r *Registry) Delete(ctx context.Context, req *WhereReq, dest interface{}) (DeleteResult, error) {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return DeleteResult{}, err
+	}
+	return db.Delete(ctx, req, dest)
+}
+
+// AutoMigrate 在默认库上建表，其他库用 Use(name) 取到 Db 后调用
+func (r *Registry) AutoMigrate(dest ...interface{}) error {
+	db, err := r.Use("")
+	if err != nil {
+		return err
+	}
+	return db.AutoMigrate(dest...)
+}
+
+func (r *Registry) Update(ctx context.Context, req *WhereReq, dest interface{}, values map[string]interface{}) (UpdateResult, error) {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	return db.Update(ctx, req, dest, values)
+}
+
+func (r *Registry) Save(ctx context.Context, req *WhereReq, dest interface{}) error {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return err
+	}
+	return db.Save(ctx, req, dest)
+}
+
+func (r *Registry) Rows(ctx context.Context, req *WhereReq, dest interface{}) (*Rows, error) {
+	db, err := r.Use(req.Db)
+	if err != nil {
+		return nil, err
+	}
+	return db.Rows(ctx, req, dest)
+}
+
+// Transaction 在默认库上开启事务，其他库用 TransactionOn
+func (r *Registry) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.TransactionOn(ctx, "", fn)
+}
+
+// TransactionOn 在 name 对应的库上开启事务，与它共用连接的库也在这个事务里
+func (r *Registry) TransactionOn(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	db, err := r.Use(name)
+	if err != nil {
+		return err
+	}
+	return db.Transaction(ctx, fn)
+}
@@ -0,0 +1,220 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ModelRegItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelRegItem{}); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	if err := r.RegisterDb("a", orm); err != nil {
+		t.Fatal(err)
+	}
+	// 与 a 共用连接、表名带库名前缀的库，即同一台服务器上的另一个库
+	shared := &Db{config: DbConfig{DbName: "other"}, db: orm.db, schema: "other", dialect: orm.dialect}
+	if err := r.RegisterDb("b", shared); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RegisterDb("a", orm); err == nil {
+		t.Errorf("expected duplicate name error")
+	}
+
+	def := NewModel(&ModelConfig{Type: &ModelRegItem{}}, r)
+	onB := NewModel(&ModelConfig{Type: &ModelRegItem{}, Db: "b"}, r)
+	var list []*ModelRegItem
+	sqlOf := func(s *Scope) string {
+		sql, err := s.ToSql(ctx, &list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sql
+	}
+	if sql := sqlOf(def.NewScope()); strings.Contains(sql, "`other`") {
+		t.Errorf("expected default db without prefix, got %s", sql)
+	}
+	if sql := sqlOf(onB.NewScope()); !strings.Contains(sql, "`other`.`dbx_reg_item`") {
+		t.Errorf("expected Model.Db routed to b, got %s", sql)
+	}
+	if sql := sqlOf(def.NewScope().UseDb("b")); !strings.Contains(sql, "`other`.`dbx_reg_item`") {
+		t.Errorf("expected UseDb routed to b, got %s", sql)
+	}
+	if err := def.NewScope().UseDb("x").Create(ctx, &ModelRegItem{Name: "x"}); err == nil {
+		t.Errorf("expected unregistered db error")
+	}
+
+	if err := def.Create(ctx, &ModelRegItem{Name: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	// 共用连接的库在同一个事务里
+	fail := errors.New("fail")
+	err := onB.Transaction(ctx, func(ctx context.Context) error {
+		if !shared.InTransaction(ctx) || !orm.InTransaction(ctx) {
+			t.Errorf("expected transaction shared by the connection")
+		}
+		if err := def.Create(ctx, &ModelRegItem{Name: "rollback"}); err != nil {
+			return err
+		}
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Errorf("expected fail, got %v", err)
+	}
+	err = r.TransactionOn(ctx, "a", func(ctx context.Context) error {
+		return def.Create(ctx, &ModelRegItem{Name: "commit"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := def.NewScope().Find(ctx, &list); err != nil || len(list) != 2 {
+		t.Errorf("unexpected rows %d %v", len(list), err)
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry()
+	a, err := r.Register("a", DbConfig{DbType: "sqlite", DbName: "file:dbx_reg_a?mode=memory&cache=shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.Register("b", DbConfig{DbType: "sqlite", DbName: "file:dbx_reg_b?mode=memory&cache=shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqlite 不能跨库访问，不同文件不共用连接，也不加库名前缀
+	if a.db == b.db || b.schema != "" {
+		t.Fatalf("expected separate connections, schema %q", b.schema)
+	}
+	a2, err := r.Register("a2", DbConfig{DbType: "sqlite", DbName: "file:dbx_reg_a?mode=memory&cache=shared"})
+	if err != nil || a2.db != a.db || a2.schema != "" {
+		t.Fatalf("expected same file to share connection, err %v", err)
+	}
+	if _, err = r.Register("a", DbConfig{DbType: "sqlite", DbName: "file:dbx_reg_c?mode=memory&cache=shared"}); err == nil {
+		t.Errorf("expected duplicate name error")
+	}
+	// 共用连接时只有建连接的库的设置生效，设置不同要报错
+	if _, err = r.Register("a3", DbConfig{DbType: "sqlite", DbName: "file:dbx_reg_a?mode=memory&cache=shared", StatementTimeout: time.Second}); err == nil || !strings.Contains(err.Error(), "StatementTimeout") {
+		t.Errorf("expected different settings error, got %v", err)
+	}
+	if _, err = r.Use("a3"); err == nil {
+		t.Errorf("expected a3 not registered")
+	}
+	for _, db := range []*Db{a, b} {
+		if err = db.AutoMigrate(&ModelRegItem{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func(db *Db) []string {
+		var list []*ModelRegItem
+		if err := NewModel(&ModelConfig{Type: &ModelRegItem{}}, db).NewScope().OrderAsc("id").Find(ctx, &list); err != nil {
+			t.Fatal(err)
+		}
+		var res []string
+		for _, v := range list {
+			res = append(res, v.Name)
+		}
+		return res
+	}
+
+	def := NewModel(&ModelConfig{Type: &ModelRegItem{}}, r)
+	onB := NewModel(&ModelConfig{Type: &ModelRegItem{}, Db: "b"}, r)
+	if err = def.Create(ctx, &ModelRegItem{Name: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = onB.Create(ctx, &ModelRegItem{Name: "model"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = onB.NewScope().UseDb("a").Create(ctx, &ModelRegItem{Name: "use"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(a); len(got) != 2 || got[0] != "default" || got[1] != "use" {
+		t.Errorf("unexpected rows in a %v", got)
+	}
+	if got := names(b); len(got) != 1 || got[0] != "model" {
+		t.Errorf("unexpected rows in b %v", got)
+	}
+	if n, err := onB.NewScope().Count(ctx); err != nil || n != 1 {
+		t.Errorf("unexpected count on b %d %v", n, err)
+	}
+	if err = def.NewScope().UseDb("x").Create(ctx, &ModelRegItem{Name: "x"}); err == nil {
+		t.Errorf("expected unregistered db error")
+	}
+
+	fail := errors.New("fail")
+	err = onB.Transaction(ctx, func(ctx context.Context) error {
+		if !b.InTransaction(ctx) || a.InTransaction(ctx) {
+			t.Errorf("expected transaction on b only")
+		}
+		if err := onB.Create(ctx, &ModelRegItem{Name: "rollback"}); err != nil {
+			return err
+		}
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Errorf("expected fail, got %v", err)
+	}
+	err = r.TransactionOn(ctx, "b", func(ctx context.Context) error {
+		return onB.Create(ctx, &ModelRegItem{Name: "commit"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(b); len(got) != 2 || got[1] != "commit" {
+		t.Errorf("unexpected rows in b after transactions %v", got)
+	}
+}
+
+func TestRegistrySubQuery(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry()
+	a, err := r.Register("a", DbConfig{DbType: "sqlite", DbName: "file:dbx_regsub_a?mode=memory&cache=shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Register("b", DbConfig{DbType: "sqlite", DbName: "file:dbx_regsub_b?mode=memory&cache=shared"}); err != nil {
+		t.Fatal(err)
+	}
+	// 与 a 共用连接、表名带库名前缀的库，如 mysql 同一台服务器上的另一个库
+	if err = r.RegisterDb("shared", &Db{config: DbConfig{DbName: "other"}, db: a.db, dialect: a.dialect, schema: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.AutoMigrate(&ModelRegItem{}); err != nil {
+		t.Fatal(err)
+	}
+	onA := NewModel(&ModelConfig{Type: &ModelRegItem{}, Db: "a"}, r)
+	onB := NewModel(&ModelConfig{Type: &ModelRegItem{}, Db: "b"}, r)
+	onShared := NewModel(&ModelConfig{Type: &ModelRegItem{}, Db: "shared"}, Intercept(r))
+
+	var list []*ModelRegItem
+	if err = onA.Where("id", "IN", onA.Select("id")).Find(ctx, &list); err != nil {
+		t.Errorf("unexpected error on same db %v", err)
+	}
+	if err = onA.Where("id", "IN", onB.Select("id")).Find(ctx, &list); err == nil {
+		t.Errorf("expected error for subquery on another connection")
+	}
+	if err = onA.NewScope().WhereExists(onB.NewScope()).Find(ctx, &list); err == nil {
+		t.Errorf("expected error for exists on another connection")
+	}
+
+	e, err := onShared.Select("id").ToExpr()
+	want := "SELECT `dbx_reg_item`.`id` FROM `other`.`dbx_reg_item` AS `dbx_reg_item` WHERE `dbx_reg_item`.`deleted_at` = 0"
+	if err != nil || e.Sql != want {
+		t.Errorf("sql %q, want %q, err %v", e.Sql, want, err)
+	}
+	if err = onA.Where("id", "IN", onShared.Select("id")).condErr(); err != nil {
+		t.Errorf("unexpected error for subquery on shared connection %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package dbx
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cylScripter/chest/log"
+	"gorm.io/gorm"
+)
+
+type ReplicaPolicy string
+
+const (
+	ReplicaRoundRobin ReplicaPolicy = "round_robin"
+	ReplicaWeighted   ReplicaPolicy = "weighted"
+)
+
+// DefaultHealthCheckInterval DbConfig.HealthCheckInterval 未设置时从库健康检查的间隔
+const DefaultHealthCheckInterval = 10 * time.Second
+
+// ReplicaPingTimeout 健康检查 ping 一个从库的超时时间，检查间隔更短时用检查间隔
+const ReplicaPingTimeout = 2 * time.Second
+
+// ReplicaConfig 从库配置，库名与主库相同，User/Password 为空时使用主库的
+type ReplicaConfig struct {
+	Ip       string
+	Port     int
+	User     string
+	Password string
+	Weight   int // ReplicaWeighted 时的权重，<=0 视为 1
+}
+
+type replica struct {
+	cfg     ReplicaConfig
+	db      *gorm.DB
+	healthy atomic.Bool
+}
+
+type replicaSet struct {
+	policy   ReplicaPolicy
+	replicas []*replica
+	next     atomic.Uint64
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newReplicaSet 打开从库时不访问数据库，启动时不可用的从库由第一次健康检查标记为不健康，不影响主库
+func newReplicaSet(d Dialect, cfg DbConfig) *replicaSet {
+	rs := &replicaSet{
+		policy: cfg.ReplicaPolicy,
+		stop:   make(chan struct{}),
+	}
+	for _, rc := range cfg.Replicas {
+		if rc.User == "" {
+			rc.User = cfg.User
+			rc.Password = cfg.Password
+		}
+		r := &replica{cfg: rc}
+		db, err := openDb(d.LazyDialector(d.Dsn(rc.User, rc.Password, rc.Ip, rc.Port, cfg.DbName)), cfg, true)
+		if err != nil {
+			// 连接配置有误，这个从库一直不分流量
+			log.Errorf("open replica %s:%d failed, err:%v", rc.Ip, rc.Port, err)
+		} else {
+			r.db = db
+			r.healthy.Store(true)
+		}
+		rs.replicas = append(rs.replicas, r)
+	}
+	interval := cfg.HealthCheckInterval
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	timeout := ReplicaPingTimeout
+	if interval < timeout {
+		timeout = interval
+	}
+	// 先检查一次，不可用的从库从一开始就不分流量
+	rs.checkAll(timeout)
+	go rs.healthCheck(interval, timeout)
+	return rs
+}
+
+// pick 按策略选一个健康的从库，全部不可用时返回 nil，由调用方回退到主库
+func (rs *replicaSet) pick() *gorm.DB {
+	if rs.policy == ReplicaWeighted {
+		return rs.pickWeighted()
+	}
+	n := uint64(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := rs.replicas[(start+i)%n]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return nil
+}
+
+func (rs *replicaSet) pickWeighted() *gorm.DB {
+	var total int
+	for _, r := range rs.replicas {
+		if r.healthy.Load() {
+			total += r.weight()
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	n := rand.Intn(total)
+	for _, r := range rs.replicas {
+		if !r.healthy.Load() {
+			continue
+		}
+		n -= r.weight()
+		if n < 0 {
+			return r.db
+		}
+	}
+	return nil
+}
+
+func (r *replica) weight() int {
+	if r.cfg.Weight <= 0 {
+		return 1
+	}
+	return r.cfg.Weight
+}
+
+func (rs *replicaSet) healthCheck(interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-ticker.C:
+		}
+		rs.checkAll(timeout)
+	}
+}
+
+// checkAll 并发 ping 所有从库并更新健康状态，最多等一个 timeout
+func (rs *replicaSet) checkAll(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, r := range rs.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			healthy := r.ping(timeout)
+			if r.healthy.Swap(healthy) != healthy {
+				log.Warnf("replica %s:%d healthy changed to %v", r.cfg.Ip, r.cfg.Port, healthy)
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (r *replica) ping(timeout time.Duration) bool {
+	if r.db == nil {
+		return false
+	}
+	sqlDb, err := r.db.DB()
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sqlDb.PingContext(ctx) == nil
+}
+
+func (rs *replicaSet) close() {
+	rs.stopOnce.Do(func() {
+		close(rs.stop)
+	})
+	for _, r := range rs.replicas {
+		if r.db == nil {
+			continue
+		}
+		if sqlDb, err := r.db.DB(); err == nil {
+			_ = sqlDb.Close()
+		}
+	}
+}
+
+// reader 读操作使用的连接：事务中用事务句柄，useMaster 或没有可用从库时用主库
+func (p *Db) reader(ctx context.Context, useMaster bool) *gorm.DB {
+	if h := p.txHandle(ctx); h != nil {
+		return h.tx.WithContext(ctx)
+	}
+	if useMaster || p.replicas == nil {
+		return p.db.WithContext(ctx)
+	}
+	if db := p.replicas.pick(); db != nil {
+		return db.WithContext(ctx)
+	}
+	return p.db.WithContext(ctx)
+}
+
+// readTable 与 table 相同，但按 reader 的规则选择连接
+func (p *Db) readTable(ctx context.Context, req *WhereReq, dest interface{}) *gorm.DB {
+	return p.from(p.reader(ctx, req.UseMaster), req, dest)
+}
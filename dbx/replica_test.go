@@ -0,0 +1,118 @@
+package dbx
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func newTestReplicaSet(policy ReplicaPolicy, weights ...int) *replicaSet {
+	rs := &replicaSet{policy: policy, stop: make(chan struct{})}
+	for _, w := range weights {
+		r := &replica{cfg: ReplicaConfig{Weight: w}, db: &gorm.DB{}}
+		r.healthy.Store(true)
+		rs.replicas = append(rs.replicas, r)
+	}
+	return rs
+}
+
+func TestReplicaPick(t *testing.T) {
+	for _, policy := range []ReplicaPolicy{ReplicaRoundRobin, ReplicaWeighted} {
+		rs := newTestReplicaSet(policy, 1, 100, 1)
+		rs.replicas[1].healthy.Store(false)
+		seen := map[*gorm.DB]int{}
+		for i := 0; i < 50; i++ {
+			seen[rs.pick()]++
+		}
+		if seen[rs.replicas[1].db] != 0 || seen[nil] != 0 {
+			t.Errorf("%s: picked unhealthy replica or nil %v", policy, seen)
+		}
+		if seen[rs.replicas[0].db] == 0 || seen[rs.replicas[2].db] == 0 {
+			t.Errorf("%s: expected both healthy replicas used, got %v", policy, seen)
+		}
+		for _, r := range rs.replicas {
+			r.healthy.Store(false)
+		}
+		if db := rs.pick(); db != nil {
+			t.Errorf("%s: expected nil when all replicas are down", policy)
+		}
+	}
+}
+
+func TestReplicaCheckAll(t *testing.T) {
+	down, err := NewDb(orm.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDb, _ := down.db.DB()
+	_ = sqlDb.Close()
+	rs := newTestReplicaSet(ReplicaRoundRobin, 1, 1)
+	rs.replicas[0].db = orm.db
+	rs.replicas[1].db = down.db
+	rs.checkAll(time.Second)
+	if !rs.replicas[0].healthy.Load() || rs.replicas[1].healthy.Load() {
+		t.Errorf("unexpected health %v %v", rs.replicas[0].healthy.Load(), rs.replicas[1].healthy.Load())
+	}
+}
+
+type ModelReplicaItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestCacheFillFromMaster(t *testing.T) {
+	ctx := context.Background()
+	db := newCacheDb(t, newFakeCache())
+	if err := db.AutoMigrate(&ModelReplicaItem{}); err != nil {
+		t.Fatal(err)
+	}
+	// 延迟的从库：还读不到刚写入的数据
+	lagging, err := NewDb(orm.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lagging.db.Callback().Query().After("gorm:query").Register("test:lagging", func(tx *gorm.DB) {
+		v := tx.Statement.ReflectValue
+		v.Set(reflect.Zero(v.Type()))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.replicas = newTestReplicaSet(ReplicaRoundRobin, 1)
+	db.replicas.replicas[0].db = lagging.db
+
+	item := NewModel(&ModelConfig{Type: &ModelReplicaItem{}}, db)
+	if err = item.Create(ctx, &ModelReplicaItem{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	var list []*ModelReplicaItem
+	if err = item.NewScope().Find(ctx, &list); err != nil || len(list) != 0 {
+		t.Fatalf("expected read from lagging replica, got %d %v", len(list), err)
+	}
+	for i := 0; i < 2; i++ {
+		list = nil
+		if err = item.NewScope().EnableCache().Find(ctx, &list); err != nil || len(list) != 1 {
+			t.Errorf("expected cache filled from master, got %d %v", len(list), err)
+		}
+	}
+}
+
+func TestReplicaDownAtStartup(t *testing.T) {
+	// 端口不可连接的从库：打开时不报错，第一次检查后不分流量
+	rs := newReplicaSet(mysqlDialect{}, DbConfig{
+		DbName:              "dbx",
+		Replicas:            []ReplicaConfig{{Ip: "127.0.0.1", Port: 1}},
+		HealthCheckInterval: time.Second,
+	})
+	defer rs.close()
+	if rs.replicas[0].healthy.Load() {
+		t.Errorf("expected replica marked unhealthy")
+	}
+	if db := rs.pick(); db != nil {
+		t.Errorf("expected no replica picked")
+	}
+}
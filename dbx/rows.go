@@ -0,0 +1,214 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// Rows 逐行读取查询结果，用完必须 Close，典型用法：
+//
+//	rows, err := scope.Rows(ctx)
+//	if err != nil { ... }
+//	defer rows.Close()
+//	for rows.Next() {
+//		var u ModelUser
+//		if err := rows.Scan(&u); err != nil { ... }
+//	}
+//	if err := rows.Err(); err != nil { ... }
+type Rows struct {
+	rows *sql.Rows
+	db   *gorm.DB
+	// list SliceRows 构造时的结果，idx 为当前行
+	list reflect.Value
+	idx  int
+	ctx  context.Context
+	// stmtCtx 带超时的查询 ctx，cancel 在 Close 时释放
+	stmtCtx context.Context
+	cancel  context.CancelFunc
+	// afterFind Scan 后调用 AfterFindHook
+	afterFind bool
+}
+
+// SliceRows 按切片构造 Rows，每个元素为一行，用于测试替身
+func SliceRows(list interface{}) *Rows {
+	return &Rows{list: reflect.Indirect(reflect.ValueOf(list)), idx: -1}
+}
+
+// Next 移到下一行，没有更多行或出错时返回 false，出错时 Err 返回错误
+func (r *Rows) Next() bool {
+	if r.rows != nil {
+		return r.rows.Next()
+	}
+	if r.list.IsValid() && r.list.Kind() == reflect.Slice {
+		r.idx++
+		return r.idx < r.list.Len()
+	}
+	return false
+}
+
+// Scan 把当前行按列名扫描到 dest，dest 为结构体指针或 *map[string]interface{}
+func (r *Rows) Scan(dest interface{}) error {
+	switch {
+	case r.rows != nil:
+		if err := r.db.ScanRows(r.rows, dest); err != nil {
+			return err
+		}
+	case r.list.IsValid() && r.idx >= 0 && r.idx < r.list.Len():
+		dv := reflect.ValueOf(dest)
+		if dv.Kind() != reflect.Ptr || dv.IsNil() {
+			return fmt.Errorf("dest required non-nil pointer, but got %T", dest)
+		}
+		el := reflect.Indirect(r.list.Index(r.idx))
+		if !el.Type().AssignableTo(dv.Elem().Type()) {
+			return fmt.Errorf("row %s can't assign to dest %T", el.Type(), dest)
+		}
+		dv.Elem().Set(el)
+	default:
+		return sql.ErrNoRows
+	}
+	if r.afterFind {
+		return callAfterFind(r.ctx, dest)
+	}
+	return nil
+}
+
+// Err 遍历过程中的错误
+func (r *Rows) Err() error {
+	if r.rows != nil {
+		return wrapTimeout(r.stmtCtx, r.rows.Err())
+	}
+	return nil
+}
+
+// Close 释放连接和超时的 ctx，可以多次调用
+func (r *Rows) Close() error {
+	if r.cancel != nil {
+		defer r.cancel()
+	}
+	if r.rows != nil {
+		return r.rows.Close()
+	}
+	return nil
+}
+
+// Rows 按 WhereReq 查询并返回逐行读取的 Rows，不经过缓存。
+// 超时从查询开始计算，覆盖整个遍历过程，超时后 Next 返回 false，Err 返回 ErrTimeout
+func (p *Db) Rows(ctx context.Context, req *WhereReq, dest interface{}) (*Rows, error) {
+	if err := p.checkLock(ctx, req); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withStatementTimeout(ctx, p.config.StatementTimeout)
+	query := p.findQuery(ctx, req, dest)
+	rows, err := query.Rows()
+	if err != nil {
+		cancel()
+		return nil, wrapTimeout(ctx, err)
+	}
+	return &Rows{rows: rows, db: query, stmtCtx: ctx, cancel: cancel}, nil
+}
+
+// Rows 逐行读取符合条件的行，不受 DefaultLimit 限制，适合导出等大结果集，见 Rows 类型的用法。
+// 遍历期间一直占用一个连接，遍历完或中途退出都要 Close；Timeout 限制从查询到遍历结束的总时间
+func (s *Scope) Rows(ctx context.Context) (*Rows, error) {
+	orders, orderArgs, err := s.orderBy()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.m.proxy.Rows(s.callCtx(ctx), &WhereReq{
+		Unscoped:    s.unscoped,
+		OnlyTrashed: s.onlyTrashed,
+		SoftDelete:  s.m.SoftDelete,
+		Cond:        []Expr{s.condExpr()},
+		Alias:       s.qualifier(),
+		Joins:       s.joins,
+		Limit:       s.limit,
+		Offset:      s.offset,
+		Orders:      orders,
+		OrderArgs:   orderArgs,
+		Lock:        s.lock,
+		Selects:     s.selectColumns(),
+		TableName:   s.GetTableName(),
+		Db:          s.db,
+		UseMaster:   s.useMaster,
+	}, s.m.getModel())
+	if err != nil {
+		return nil, err
+	}
+	rows.ctx = ctx
+	rows.afterFind = true
+	return rows, nil
+}
+
+// Chunk 按主键顺序每次查 size 行（<=0 时为 DefaultBatchSize），把 []*模型 传给 fn，
+// 用 主键 > 上一批最后的主键 翻页，不受 DefaultLimit 限制，中途写表也不会漏行或重复。
+// 只使用 Scope 的条件、Select 和软删除过滤，忽略排序和分页；fn 返回 error 时停止并返回该错误
+func (s *Scope) Chunk(ctx context.Context, size int, fn func(batch interface{}) error) error {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	if err := s.condErr(); err != nil {
+		return err
+	}
+	sch, err := parseSchema(s.m.getModel())
+	if err != nil {
+		return err
+	}
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return fmt.Errorf("chunk on %s requires a primary key", s.GetTableName())
+	}
+	alias := s.qualifier()
+	col := quoteFieldName(pk.DBName)
+	if alias != "" {
+		col = qualifyColumn(pk.DBName, alias)
+	}
+	sliceType := reflect.SliceOf(reflect.PtrTo(s.m.typ))
+	var last interface{}
+	for {
+		cond := []Expr{s.condExpr()}
+		if last != nil {
+			cond = append(cond, Expr{Sql: col + " > ?", Args: []interface{}{last}})
+		}
+		batch := reflect.New(sliceType)
+		err = s.m.proxy.Find(s.callCtx(ctx), &WhereReq{
+			Unscoped:    s.unscoped,
+			OnlyTrashed: s.onlyTrashed,
+			SoftDelete:  s.m.SoftDelete,
+			Cond:        cond,
+			Alias:       alias,
+			Joins:       s.joins,
+			Limit:       uint32(size),
+			Orders:      []string{col + " ASC"},
+			Lock:        s.lock,
+			Selects:     s.selectColumns(),
+			TableName:   s.GetTableName(),
+			Db:          s.db,
+			UseMaster:   s.useMaster,
+		}, batch.Interface())
+		if err != nil {
+			return err
+		}
+		list := batch.Elem()
+		if list.Len() == 0 {
+			return nil
+		}
+		if err = callAfterFind(ctx, batch.Interface()); err != nil {
+			return err
+		}
+		var zero bool
+		last, zero = pk.ValueOf(ctx, list.Index(list.Len()-1).Elem())
+		if zero {
+			return fmt.Errorf("chunk on %s requires %s in Select", s.GetTableName(), pk.DBName)
+		}
+		if err = fn(list.Interface()); err != nil {
+			return err
+		}
+		if list.Len() < size {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type ModelChunkItem struct {
+	Id        int32 `json:"id"`
+	Kind      int32 `json:"kind"`
+	DeletedAt int32 `json:"deleted_at"`
+}
+
+func TestChunkAndRows(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelChunkItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelChunkItem{}}, orm)
+	var list []*ModelChunkItem
+	for i := 0; i < 8; i++ {
+		v := &ModelChunkItem{Kind: int32(i % 2)}
+		if i == 6 {
+			v.DeletedAt = 1
+		}
+		list = append(list, v)
+	}
+	if _, err := item.NewScope().CreateInBatches(ctx, list, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int32
+	var batches []int
+	err := item.Where("kind", 0).OrderDesc("id").Chunk(ctx, 2, func(batch interface{}) error {
+		rows := batch.([]*ModelChunkItem)
+		batches = append(batches, len(rows))
+		for _, v := range rows {
+			ids = append(ids, v.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// id 7 已软删除
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 3 || ids[2] != 5 || len(batches) != 2 {
+		t.Errorf("unexpected chunk %v %v", ids, batches)
+	}
+	stop := errors.New("stop")
+	calls := 0
+	err = item.NewScope().Chunk(ctx, 3, func(batch interface{}) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("expected stop after first batch, got %v %d", err, calls)
+	}
+
+	rows, err := item.Where("kind", 1).OrderDesc("id").Rows(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	ids = nil
+	for rows.Next() {
+		var v ModelChunkItem
+		if err = rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, v.Id)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 4 || ids[0] != 8 || ids[3] != 2 {
+		t.Errorf("unexpected rows %v", ids)
+	}
+}
@@ -9,8 +9,9 @@ import (
 	"github.com/cylScripter/openapi/base"
 	"gorm.io/gorm"
 	"k8s.io/apimachinery/pkg/util/json"
-	"reflect"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Scope struct {
@@ -21,18 +22,26 @@ type Scope struct {
 	limit               uint32
 	offset              uint32
 	needCount           bool
-	orderDesc           bool
 	selects             []string
 	skips               []string
 	groups              []string
-	orders              []string
+	having              Cond
+	orders              []orderTerm
 	trId                string
 	ignoreConflict      bool
 	unscoped            bool
+	onlyTrashed         bool
+	skipTimestamps      bool
+	alias               string
+	joins               []Expr
+	lock                *Lock
 	returnUnknownFields bool
 	enableCache         bool
 	showSql             bool
+	timeout             time.Duration
 	ignoreBroken        bool
+	useMaster           bool
+	countStrategy       CountStrategy
 	rowsAffected        uint64
 }
 
@@ -40,26 +49,11 @@ func (s *Scope) GetModel() *Model {
 	return s.m
 }
 
+// Model 换成 model 对应的 Model，保留原 Model 的其他配置
 func (s *Scope) Model(model interface{}) *Scope {
-	m := &Model{
-		ModelConfig: ModelConfig{
-			Type:            model,
-			NotFoundErrCode: s.m.NotFoundErrCode,
-			Db:              s.m.Db,
-		},
-		proxy: s.m.proxy,
-	}
-	if m.Type == nil {
-		panic("Type nil")
-	}
-	typ := reflect.TypeOf(m.Type)
-	for typ.Kind() == reflect.Ptr {
-		typ = typ.Elem()
-	}
-	m.typ = typ
-	m.modelType = fmt.Sprintf("%T", m.Type)
-	m.tableName = utils.CamelToSnake(m.modelType)
-	s.m = m
+	cfg := s.m.ModelConfig
+	cfg.Type = model
+	s.m = NewModel(&cfg, s.m.proxy)
 	return s
 }
 
@@ -92,6 +86,13 @@ func (s *Scope) SetOffset(offset uint32) *Scope {
 	s.offset = offset
 	return s
 }
+
+// SetCountStrategy FindPaginate 计算总数的方式，默认 CountExact
+func (s *Scope) SetCountStrategy(strategy CountStrategy) *Scope {
+	s.countStrategy = strategy
+	return s
+}
+
 func (s *Scope) Omit(columns ...string) *Scope {
 	s.skips = append(s.skips, columns...)
 	return s
@@ -100,15 +101,37 @@ func (s *Scope) Group(fields ...string) *Scope {
 	s.groups = append(s.groups, fields...)
 	return s
 }
+
+// Having 分组后的过滤条件，写法与 Where 相同，可以引用 Select 中的别名，
+// 如 Select("user_id", "SUM(amount) AS total").Group("user_id").Having("total >", 100)
+// 或 Having("COUNT(*) > ?", 1)。字段不会自动加上主表别名
+func (s *Scope) Having(args ...interface{}) *Scope {
+	s.having.isTopLevel = true
+	s.having.Where(args...)
+	return s
+}
+
+// EnableCache Find/First/Count 的结果缓存到 DbConfig.Cache，同表的写操作会让缓存失效，事务中不走缓存。
+// 带 Join 或子查询的查询不缓存：缓存只跟着主表的版本号失效，其他表的写入不会让它失效
 func (s *Scope) EnableCache() *Scope {
 	s.enableCache = true
 	return s
 }
 
+// cacheable EnableCache 后查询结果能否缓存，见 EnableCache
+func (s *Scope) cacheable() bool {
+	return s.enableCache && len(s.joins) == 0 && len(s.cond.subs) == 0 && len(s.having.subs) == 0
+}
+
 func (s *Scope) ResetGroup(fields ...string) *Scope {
 	s.groups = append([]string{}, fields...)
 	return s
 }
+
+// Transaction 只记录 trId，不会开启事务。
+//
+// Deprecated: 事务句柄通过 ctx 传递，使用 Db.Transaction 或 Model.Transaction，
+// 并在回调里用传入的 ctx 调用 Scope 的方法
 func (s *Scope) Transaction(trId string) *Scope {
 	s.trId = trId
 	return s
@@ -118,41 +141,21 @@ func (s *Scope) ResetSelect(fields ...string) *Scope {
 	s.selects = append([]string{}, fields...)
 	return s
 }
-func (s *Scope) OrderAsc(fields ...string) *Scope {
-	s.orders = append(s.orders, fields...)
-	s.orderDesc = false
-	return s
-}
-func (s *Scope) OrderDesc(fields ...string) *Scope {
-	s.orders = append(s.orders, fields...)
-	s.orderDesc = true
-	return s
-}
-func (s *Scope) ResetOrderAsc(fields ...string) *Scope {
-	s.orders = append([]string{}, fields...)
-	s.orderDesc = false
-	return s
-}
-func (s *Scope) ResetOrderDesc(fields ...string) *Scope {
-	s.orders = append([]string{}, fields...)
-	s.orderDesc = true
-	return s
+func (s *Scope) getGroup() string {
+	return strings.Join(s.qualifyList(s.groups), ",")
 }
-func (s *Scope) getOrder() string {
-	if len(s.orders) > 0 {
-		o := strings.Join(s.orders, ",")
-		var c string
-		if s.orderDesc {
-			c = "DESC"
-		} else {
-			c = "ASC"
-		}
-		return fmt.Sprintf("%s %s", o, c)
+
+// qualifyList 给逗号分隔的字段加上主表别名
+func (s *Scope) qualifyList(list []string) []string {
+	alias := s.qualifier()
+	if alias == "" {
+		return list
 	}
-	return ""
-}
-func (s *Scope) getGroup() string {
-	return strings.Join(s.groups, ",")
+	var res []string
+	for _, v := range list {
+		res = append(res, qualifyColumns(strings.Split(v, ","), alias)...)
+	}
+	return res
 }
 func (s *Scope) GetTableName() string {
 	if s.table != "" {
@@ -196,10 +199,15 @@ func (s *Scope) OrWhere(args ...interface{}) *Scope {
 	return s
 }
 
+// GetCondString 返回带 ? 占位符的条件，参数见 GetCondArgs
 func (s *Scope) GetCondString() string {
 	return s.cond.ToString()
 }
 
+func (s *Scope) GetCondArgs() []interface{} {
+	return s.cond.Args()
+}
+
 func (s *Scope) Select(fields ...string) *Scope {
 	s.selects = append(s.selects, fields...)
 	return s
@@ -210,105 +218,230 @@ func (s *Scope) Find(ctx context.Context, dest interface{}) error {
 	if len(s.groups) > 0 {
 		s.needCount = true
 	}
-	var orders []string
-	if len(s.orders) > 0 {
-		orders = append(orders, s.getOrder())
-	}
-	return s.m.proxy.Find(ctx, &WhereReq{
-		Unscoped:  s.unscoped,
-		Cond:      []string{s.GetCondString()},
-		Groups:    []string{s.getGroup()},
-		Limit:     s.limit,
-		Offset:    s.offset,
-		Orders:    orders,
-		Selects:   s.selects,
-		TableName: s.GetTableName(),
+	orders, orderArgs, err := s.orderBy()
+	if err != nil {
+		return err
+	}
+	err = s.m.proxy.Find(s.callCtx(ctx), &WhereReq{
+		needGroup:   s.needCount,
+		Unscoped:    s.unscoped,
+		OnlyTrashed: s.onlyTrashed,
+		SoftDelete:  s.m.SoftDelete,
+		Cond:        []Expr{s.condExpr()},
+		Alias:       s.qualifier(),
+		Joins:       s.joins,
+		Groups:      []string{s.getGroup()},
+		Having:      []Expr{s.having.ToExpr()},
+		Limit:       s.limit,
+		Offset:      s.offset,
+		Orders:      orders,
+		OrderArgs:   orderArgs,
+		Lock:        s.lock,
+		Selects:     s.selectColumns(),
+		TableName:   s.GetTableName(),
+		Db:          s.db,
+		UseMaster:   s.useMaster,
+		EnableCache: s.cacheable(),
 	}, dest)
+	if err != nil {
+		return err
+	}
+	return callAfterFind(ctx, dest)
 }
 func (s *Scope) ToSql(ctx context.Context, dest interface{}) (string, error) {
-	model := s.m.getModel()
-	s.Model(model)
 	if len(s.groups) > 0 {
 		s.needCount = true
 	}
-	return s.m.proxy.ToSql(ctx, &WhereReq{
-		Cond:      []string{s.GetCondString()},
-		Groups:    []string{s.getGroup()},
-		Limit:     s.limit,
-		Offset:    s.offset,
-		Orders:    []string{s.getOrder()},
-		Selects:   s.selects,
-		needGroup: s.needCount,
-		TableName: s.GetTableName(),
+	orders, orderArgs, err := s.orderBy()
+	if err != nil {
+		return "", err
+	}
+	return s.m.proxy.ToSql(s.callCtx(ctx), &WhereReq{
+		Unscoped:    s.unscoped,
+		OnlyTrashed: s.onlyTrashed,
+		SoftDelete:  s.m.SoftDelete,
+		Cond:        []Expr{s.condExpr()},
+		Alias:       s.qualifier(),
+		Joins:       s.joins,
+		Groups:      []string{s.getGroup()},
+		Having:      []Expr{s.having.ToExpr()},
+		Limit:       s.limit,
+		Offset:      s.offset,
+		Orders:      orders,
+		OrderArgs:   orderArgs,
+		Lock:        s.lock,
+		Selects:     s.selectColumns(),
+		needGroup:   s.needCount,
+		TableName:   s.GetTableName(),
+		Db:          s.db,
 	}, dest)
 }
 func (s *Scope) First(ctx context.Context, dest interface{}) error {
 	if len(s.groups) > 0 {
 		s.needCount = true
 	}
-	var orders []string
-	if len(s.orders) > 0 {
-		orders = append(orders, s.getOrder())
-	}
-	return s.m.proxy.First(ctx, &WhereReq{
-		needGroup: s.needCount,
-		Unscoped:  s.unscoped,
-		Cond:      []string{s.GetCondString()},
-		Groups:    []string{s.getGroup()},
-		Limit:     s.limit,
-		Offset:    s.offset,
-		Orders:    orders,
-		Selects:   s.selects,
-		TableName: s.GetTableName(),
+	orders, orderArgs, err := s.orderBy()
+	if err != nil {
+		return err
+	}
+	err = s.m.proxy.First(s.callCtx(ctx), &WhereReq{
+		needGroup:   s.needCount,
+		Unscoped:    s.unscoped,
+		OnlyTrashed: s.onlyTrashed,
+		SoftDelete:  s.m.SoftDelete,
+		Cond:        []Expr{s.condExpr()},
+		Alias:       s.qualifier(),
+		Joins:       s.joins,
+		Groups:      []string{s.getGroup()},
+		Having:      []Expr{s.having.ToExpr()},
+		Limit:       s.limit,
+		Offset:      s.offset,
+		Orders:      orders,
+		OrderArgs:   orderArgs,
+		Lock:        s.lock,
+		Selects:     s.selectColumns(),
+		TableName:   s.GetTableName(),
+		Db:          s.db,
+		UseMaster:   s.useMaster,
+		EnableCache: s.cacheable(),
 	}, dest)
+	if err != nil {
+		return err
+	}
+	return callAfterFind(ctx, dest)
 }
 func (s *Scope) FindPaginate(ctx context.Context, dest interface{}) (*base.Paginate, error) {
 	if len(s.groups) > 0 {
 		s.needCount = true
 	}
-	var orders []string
-	if len(s.orders) > 0 {
-		orders = append(orders, s.getOrder())
-	}
-	return s.m.proxy.FindPaginate(ctx, &WhereReq{
-		needGroup: s.needCount,
-		Unscoped:  s.unscoped,
-		Cond:      []string{s.GetCondString()},
-		Groups:    []string{s.getGroup()},
-		Limit:     s.limit,
-		Offset:    s.offset,
-		Orders:    orders,
-		Selects:   s.selects,
-		TableName: s.GetTableName(),
+	orders, orderArgs, err := s.orderBy()
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.m.proxy.FindPaginate(s.callCtx(ctx), &WhereReq{
+		needGroup:     s.needCount,
+		Unscoped:      s.unscoped,
+		OnlyTrashed:   s.onlyTrashed,
+		SoftDelete:    s.m.SoftDelete,
+		Cond:          []Expr{s.condExpr()},
+		Alias:         s.qualifier(),
+		Joins:         s.joins,
+		Groups:        []string{s.getGroup()},
+		Having:        []Expr{s.having.ToExpr()},
+		Limit:         s.limit,
+		Offset:        s.offset,
+		Orders:        orders,
+		OrderArgs:     orderArgs,
+		Selects:       s.selectColumns(),
+		TableName:     s.GetTableName(),
+		Db:            s.db,
+		UseMaster:     s.useMaster,
+		CountStrategy: s.countStrategy,
 	}, dest)
+	if err != nil {
+		return nil, err
+	}
+	return res, callAfterFind(ctx, dest)
 }
 func (s *Scope) Create(ctx context.Context, dest interface{}) error {
-	return s.m.proxy.Create(ctx, &CreateReq{
-		TableName: s.GetTableName(),
-		Selects:   s.selects,
-		Omit:      s.skips,
-	}, dest)
+	if err := s.stamp(ctx, dest, false); err != nil {
+		return err
+	}
+	if err := callBeforeCreate(ctx, dest); err != nil {
+		return err
+	}
+	return s.withAfterHook(ctx, hasHook(dest, afterCreateHookType), func(ctx context.Context) error {
+		err := s.m.proxy.Create(s.callCtx(ctx), &CreateReq{
+			TableName:      s.GetTableName(),
+			Db:             s.db,
+			Selects:        s.selects,
+			Omit:           append(s.autoTimeOmits(ctx, dest), s.skips...),
+			IgnoreConflict: s.ignoreConflict,
+		}, dest)
+		if err != nil {
+			return err
+		}
+		return callAfterCreate(ctx, dest)
+	})
+}
+
+// CreateInBatches 分批插入 list（切片或切片的指针），每批 batchSize 条，<=0 时为 DefaultBatchSize
+func (s *Scope) CreateInBatches(ctx context.Context, list interface{}, batchSize int) (CreateResult, error) {
+	if err := s.stamp(ctx, list, false); err != nil {
+		return CreateResult{}, err
+	}
+	if err := callBeforeCreate(ctx, list); err != nil {
+		return CreateResult{}, err
+	}
+	var res CreateResult
+	err := s.withAfterHook(ctx, hasHook(list, afterCreateHookType), func(ctx context.Context) error {
+		var err error
+		res, err = s.m.proxy.CreateInBatches(s.callCtx(ctx), &CreateReq{
+			TableName:      s.GetTableName(),
+			Db:             s.db,
+			Selects:        s.selects,
+			Omit:           append(s.autoTimeOmits(ctx, list), s.skips...),
+			IgnoreConflict: s.ignoreConflict,
+			BatchSize:      batchSize,
+		}, list)
+		if err != nil {
+			return err
+		}
+		return callAfterCreate(ctx, list)
+	})
+	if err != nil {
+		return CreateResult{}, err
+	}
+	return res, nil
+}
+
+// IgnoreConflict Create/CreateInBatches 跳过唯一键冲突的行而不是报错
+func (s *Scope) IgnoreConflict() *Scope {
+	s.ignoreConflict = true
+	return s
 }
 func (s *Scope) Count(ctx context.Context) (int64, error) {
 	model := s.m.getModel()
 	if len(s.groups) > 0 {
 		s.needCount = true
 	}
-	var orders []string
-	if len(s.orders) > 0 {
-		orders = append(orders, s.getOrder())
-	}
-	return s.m.proxy.Count(ctx, &WhereReq{
-		Unscoped:  s.unscoped,
-		Limit:     s.limit,
-		Offset:    s.offset,
-		Cond:      []string{s.GetCondString()},
-		Groups:    []string{s.getGroup()},
-		needGroup: s.needCount,
-		Orders:    orders,
-		TableName: s.GetTableName(),
+	orders, orderArgs, err := s.orderBy()
+	if err != nil {
+		return 0, err
+	}
+	// 分组计数时 HAVING 可能引用 Select 的别名
+	var selects []string
+	if s.needCount && len(s.selects) > 0 {
+		selects = s.selectColumns()
+	}
+	return s.m.proxy.Count(s.callCtx(ctx), &WhereReq{
+		Unscoped:    s.unscoped,
+		OnlyTrashed: s.onlyTrashed,
+		SoftDelete:  s.m.SoftDelete,
+		Limit:       s.limit,
+		Offset:      s.offset,
+		Cond:        []Expr{s.condExpr()},
+		Alias:       s.qualifier(),
+		Joins:       s.joins,
+		Groups:      []string{s.getGroup()},
+		Having:      []Expr{s.having.ToExpr()},
+		needGroup:   s.needCount,
+		Selects:     selects,
+		Orders:      orders,
+		OrderArgs:   orderArgs,
+		TableName:   s.GetTableName(),
+		Db:          s.db,
+		UseMaster:   s.useMaster,
+		EnableCache: s.cacheable(),
 	}, model)
 }
+
+// UseMaster 读操作也走主库，用于写后立即读
+func (s *Scope) UseMaster() *Scope {
+	s.useMaster = true
+	return s
+}
+
 func (s *Scope) UseDb(db string) *Scope {
 	s.db = db
 	return s
@@ -319,50 +452,146 @@ func (s *Scope) UseTable(table string) *Scope {
 	return s
 }
 func (s *Scope) Update(ctx context.Context, values map[string]interface{}) (UpdateResult, error) {
+	if err := s.condErr(); err != nil {
+		return UpdateResult{}, err
+	}
 	model := s.m.getModel()
-	return s.m.proxy.Update(ctx, &WhereReq{
-		Unscoped:  s.unscoped,
-		Cond:      []string{s.GetCondString()},
-		TableName: s.GetTableName(),
-	}, model, values)
-
+	values = s.stampValues(values)
+	target := s.hookTarget()
+	if err := callBeforeUpdate(ctx, target, values); err != nil {
+		return UpdateResult{}, err
+	}
+	var res UpdateResult
+	err := s.withAfterHook(ctx, hasHook(target, afterUpdateHookType), func(ctx context.Context) error {
+		var err error
+		res, err = s.m.proxy.Update(s.callCtx(ctx), &WhereReq{
+			Unscoped:     s.unscoped,
+			OnlyTrashed:  s.onlyTrashed,
+			SoftDelete:   s.m.SoftDelete,
+			Cond:         []Expr{s.cond.ToExpr()},
+			SkipAutoTime: s.skipAutoTime(),
+			TableName:    s.GetTableName(),
+			Db:           s.db,
+		}, model, values)
+		if err != nil {
+			return err
+		}
+		return callAfterUpdate(ctx, target, values)
+	})
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	return res, nil
 }
 func (s *Scope) Delete(ctx context.Context) (DeleteResult, error) {
+	return s.delete(ctx, false)
+}
+
+func (s *Scope) delete(ctx context.Context, hard bool) (DeleteResult, error) {
+	if err := s.condErr(); err != nil {
+		return DeleteResult{}, err
+	}
 	model := s.m.getModel()
-	return s.m.proxy.Delete(ctx, &WhereReq{
-		Unscoped:  s.unscoped,
-		Cond:      []string{s.GetCondString()},
-		TableName: s.GetTableName(),
-	}, model)
+	target := s.hookTarget()
+	if err := callBeforeDelete(ctx, target); err != nil {
+		return DeleteResult{}, err
+	}
+	var res DeleteResult
+	err := s.withAfterHook(ctx, hasHook(target, afterDeleteHookType), func(ctx context.Context) error {
+		var err error
+		res, err = s.m.proxy.Delete(s.callCtx(ctx), &WhereReq{
+			Unscoped:    s.unscoped,
+			OnlyTrashed: s.onlyTrashed,
+			SoftDelete:  s.m.SoftDelete,
+			HardDelete:  hard,
+			Cond:        []Expr{s.cond.ToExpr()},
+			TableName:   s.GetTableName(),
+			Db:          s.db,
+		}, model)
+		if err != nil {
+			return err
+		}
+		return callAfterDelete(ctx, target)
+	})
+	if err != nil {
+		return DeleteResult{}, err
+	}
+	return res, nil
 }
 
+// Upsert 用一条 INSERT ... ON DUPLICATE KEY UPDATE（或方言的等价语句）插入 obj，
+// 与 conflictColumns 上已有的行冲突时更新 updateColumns，updateColumns 为空时保留已有的行。
+// mysql 按表上的唯一索引判断冲突，postgres 和 sqlite 必须指定 conflictColumns
+func (s *Scope) Upsert(ctx context.Context, obj interface{}, conflictColumns []string, updateColumns []string) (UpdateOrCreateResult, error) {
+	if err := s.stamp(ctx, obj, true); err != nil {
+		return UpdateOrCreateResult{}, err
+	}
+	if err := callBeforeCreate(ctx, obj); err != nil {
+		return UpdateOrCreateResult{}, err
+	}
+	var res UpdateOrCreateResult
+	err := s.withAfterHook(ctx, hasHook(obj, afterCreateHookType), func(ctx context.Context) error {
+		var err error
+		res, err = s.m.proxy.Upsert(s.callCtx(ctx), &CreateReq{
+			TableName:       s.GetTableName(),
+			Db:              s.db,
+			Selects:         s.selects,
+			Omit:            append(s.autoTimeOmits(ctx, obj), s.skips...),
+			ConflictColumns: conflictColumns,
+			UpdateColumns:   s.stampColumns(obj, updateColumns),
+		}, obj)
+		if err != nil || !res.Created {
+			return err
+		}
+		return callAfterCreate(ctx, obj)
+	})
+	if err != nil {
+		return UpdateOrCreateResult{}, err
+	}
+	return res, nil
+}
+
+// FirstOrCreate 按 attributes 查找，不存在时用 attributes 和 values 创建。
+// 创建时忽略唯一键冲突，被并发的调用抢先插入时重新查出那一行，attributes 需要对应表上的唯一索引
 func (s *Scope) FirstOrCreate(ctx context.Context, attributes map[string]interface{}, values map[string]interface{}, obj interface{}) (FirstOrCreateResult, error) {
 	res := FirstOrCreateResult{}
 	err := s.Where(attributes).First(ctx, obj)
+	if err == nil {
+		return res, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return FirstOrCreateResult{}, err
+	}
 	all := make(map[string]interface{})
+	for k, v := range attributes {
+		all[k] = v
+	}
+	for k, v := range values {
+		all[k] = v
+	}
+	if err = map2Interface(all, obj); err != nil {
+		return FirstOrCreateResult{}, err
+	}
+	conflictColumns := make([]string, 0, len(attributes))
+	for k := range attributes {
+		conflictColumns = append(conflictColumns, k)
+	}
+	sort.Strings(conflictColumns)
+	r, err := s.Upsert(ctx, obj, conflictColumns, nil)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			for k, v := range attributes {
-				all[k] = v
-			}
-			for k, v := range values {
-				all[k] = v
-			}
-			err = map2Interface(all, obj)
-			err = s.Create(ctx, obj)
-			if err != nil {
-				return FirstOrCreateResult{}, err
-			} else {
-				res.Created = true
-			}
-
-		} else {
+		return FirstOrCreateResult{}, err
+	}
+	if !r.Created {
+		// 并发插入的行在主库上，从库可能还没同步
+		if err = s.UseMaster().First(ctx, obj); err != nil {
 			return FirstOrCreateResult{}, err
 		}
 	}
+	res.Created = r.Created
 	return res, nil
 }
 
+// FirstOrUpdate 按 attributes 查找并更新为 values，记录不存在时返回 gorm.ErrRecordNotFound，Created 始终为 false
 func (s *Scope) FirstOrUpdate(ctx context.Context, attributes map[string]interface{}, values map[string]interface{}, obj interface{}) (FirstOrCreateResult, error) {
 	res := FirstOrCreateResult{}
 	err := s.Where(attributes).First(ctx, obj)
@@ -384,15 +613,29 @@ func (s *Scope) FirstOrUpdate(ctx context.Context, attributes map[string]interfa
 	if err != nil {
 		return FirstOrCreateResult{}, err
 	}
-	res.Created = true
 
 	return res, nil
 }
 
 func (s *Scope) Save(ctx context.Context, dest interface{}) error {
-	return s.m.proxy.Save(ctx, &WhereReq{
-		TableName: s.GetTableName(),
-	}, dest)
+	if err := s.stamp(ctx, dest, true); err != nil {
+		return err
+	}
+	if err := callBeforeUpdate(ctx, dest, nil); err != nil {
+		return err
+	}
+	return s.withAfterHook(ctx, hasHook(dest, afterUpdateHookType), func(ctx context.Context) error {
+		err := s.m.proxy.Save(s.callCtx(ctx), &WhereReq{
+			Omit:         s.autoTimeOmits(ctx, dest),
+			SkipAutoTime: s.skipAutoTime(),
+			TableName:    s.GetTableName(),
+			Db:           s.db,
+		}, dest)
+		if err != nil {
+			return err
+		}
+		return callAfterUpdate(ctx, dest, nil)
+	})
 }
 
 func map2Interface(m map[string]interface{}, i interface{}) error {
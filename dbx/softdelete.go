@@ -0,0 +1,136 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SoftDeleteMode 软删除标记的存储方式
+type SoftDeleteMode int
+
+const (
+	// SoftDeleteUnix 整数秒时间戳，0 为未删除
+	SoftDeleteUnix SoftDeleteMode = iota
+	// SoftDeleteDatetime 可为空的 datetime，NULL 为未删除
+	SoftDeleteDatetime
+	// SoftDeleteFlag 布尔标记，false 为未删除
+	SoftDeleteFlag
+	// SoftDeleteNone 没有软删除列，Delete 直接删除
+	SoftDeleteNone
+)
+
+// SoftDelete 软删除策略，在 ModelConfig 中按表配置，零值为 deleted_at 整数秒时间戳
+type SoftDelete struct {
+	Mode SoftDeleteMode
+	// Column 软删除列，默认 deleted_at，SoftDeleteFlag 默认 is_deleted
+	Column string
+}
+
+func (d SoftDelete) column() string {
+	if d.Column != "" {
+		return d.Column
+	}
+	if d.Mode == SoftDeleteFlag {
+		return "is_deleted"
+	}
+	return "deleted_at"
+}
+
+// quotedColumn 软删除列，alias 非空时带上表的别名
+func (d SoftDelete) quotedColumn(alias string) string {
+	if alias != "" {
+		return quoteFieldName(alias + "." + d.column())
+	}
+	return quoteFieldName(d.column())
+}
+
+// aliveCond 未删除的行
+func (d SoftDelete) aliveCond(alias string) Expr {
+	col := d.quotedColumn(alias)
+	switch d.Mode {
+	case SoftDeleteDatetime:
+		return Expr{Sql: col + " IS NULL"}
+	case SoftDeleteFlag:
+		return Expr{Sql: col + " = ?", Args: []interface{}{false}}
+	default:
+		return Expr{Sql: col + " = 0"}
+	}
+}
+
+// trashedCond 已删除的行，没有软删除列时不匹配任何行
+func (d SoftDelete) trashedCond(alias string) Expr {
+	col := d.quotedColumn(alias)
+	switch d.Mode {
+	case SoftDeleteDatetime:
+		return Expr{Sql: col + " IS NOT NULL"}
+	case SoftDeleteFlag:
+		return Expr{Sql: col + " = ?", Args: []interface{}{true}}
+	case SoftDeleteNone:
+		return Expr{Sql: "1 = 0"}
+	default:
+		return Expr{Sql: col + " <> 0"}
+	}
+}
+
+func (d SoftDelete) deletedValue() interface{} {
+	switch d.Mode {
+	case SoftDeleteDatetime:
+		return time.Now()
+	case SoftDeleteFlag:
+		return true
+	default:
+		return time.Now().Unix()
+	}
+}
+
+func (d SoftDelete) restoredValue() interface{} {
+	switch d.Mode {
+	case SoftDeleteDatetime:
+		return nil
+	case SoftDeleteFlag:
+		return false
+	default:
+		return 0
+	}
+}
+
+// softDeleteCond 按 Unscoped/OnlyTrashed 和软删除策略生成过滤条件
+func (req *WhereReq) softDeleteCond() []Expr {
+	if req.OnlyTrashed {
+		return []Expr{req.SoftDelete.trashedCond(req.Alias)}
+	}
+	if req.Unscoped || req.SoftDelete.Mode == SoftDeleteNone {
+		return nil
+	}
+	return []Expr{req.SoftDelete.aliveCond(req.Alias)}
+}
+
+// OnlyTrashed 只查询已软删除的行
+func (s *Scope) OnlyTrashed() *Scope {
+	s.onlyTrashed = true
+	return s
+}
+
+// Restore 恢复条件匹配的已软删除的行
+func (s *Scope) Restore(ctx context.Context) (UpdateResult, error) {
+	sd := s.m.SoftDelete
+	if sd.Mode == SoftDeleteNone {
+		return UpdateResult{}, fmt.Errorf("table %s has no soft delete column", s.GetTableName())
+	}
+	if err := s.condErr(); err != nil {
+		return UpdateResult{}, err
+	}
+	return s.m.proxy.Update(s.callCtx(ctx), &WhereReq{
+		OnlyTrashed: true,
+		SoftDelete:  sd,
+		Cond:        []Expr{s.cond.ToExpr()},
+		TableName:   s.GetTableName(),
+		Db:          s.db,
+	}, s.m.getModel(), map[string]interface{}{sd.column(): sd.restoredValue()})
+}
+
+// ForceDelete 物理删除条件匹配的行，默认不包含已软删除的行，需要时配合 Unscoped 或 OnlyTrashed
+func (s *Scope) ForceDelete(ctx context.Context) (DeleteResult, error) {
+	return s.delete(ctx, true)
+}
@@ -0,0 +1,93 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/cylScripter/chest/log"
+	"gorm.io/gorm"
+)
+
+// DefaultSlowThreshold DbConfig.SlowThreshold 的默认值
+const DefaultSlowThreshold = 200 * time.Millisecond
+
+const sqlLogStartKey = "dbx:sql_log_start"
+
+type showSqlKey struct{}
+
+// WithShowSql ctx 上执行的语句都按 Info 打印，不受日志级别为 Debug 的限制
+func WithShowSql(ctx context.Context) context.Context {
+	return context.WithValue(ctx, showSqlKey{}, true)
+}
+
+func isShowSql(ctx context.Context) bool {
+	v, _ := ctx.Value(showSqlKey{}).(bool)
+	return v
+}
+
+// ShowSql 本次调用的语句按 Info 打印
+func (s *Scope) ShowSql() *Scope {
+	s.showSql = true
+	return s
+}
+
+// registerSqlLog 在 gorm 的各类语句前后记录耗时并打印，请求 id 由 log.Ctx* 从 ctx 中取。
+// 语句按 Debug 打印，超过 slow 的按 Warn，出错时按 Warn 并带上错误（记录不存在除外）。
+// 默认只打印带占位符的语句和参数个数，values 为 true 时把参数值代入语句
+func registerSqlLog(db *gorm.DB, slow time.Duration, values bool) error {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(sqlLogStartKey, time.Now())
+	}
+	after := func(tx *gorm.DB) {
+		logSql(tx, slow, values)
+	}
+	cb := db.Callback()
+	regs := []error{
+		cb.Create().Before("gorm:create").Register("dbx:sql_log_start", before),
+		cb.Create().After("gorm:create").Register("dbx:sql_log", after),
+		cb.Query().Before("gorm:query").Register("dbx:sql_log_start", before),
+		cb.Query().After("gorm:query").Register("dbx:sql_log", after),
+		cb.Update().Before("gorm:update").Register("dbx:sql_log_start", before),
+		cb.Update().After("gorm:update").Register("dbx:sql_log", after),
+		cb.Delete().Before("gorm:delete").Register("dbx:sql_log_start", before),
+		cb.Delete().After("gorm:delete").Register("dbx:sql_log", after),
+		cb.Row().Before("gorm:row").Register("dbx:sql_log_start", before),
+		cb.Row().After("gorm:row").Register("dbx:sql_log", after),
+		cb.Raw().Before("gorm:raw").Register("dbx:sql_log_start", before),
+		cb.Raw().After("gorm:raw").Register("dbx:sql_log", after),
+	}
+	return errors.Join(regs...)
+}
+
+func logSql(tx *gorm.DB, slow time.Duration, values bool) {
+	stmt := tx.Statement
+	if tx.DryRun || stmt.SQL.Len() == 0 {
+		return
+	}
+	v, ok := tx.InstanceGet(sqlLogStartKey)
+	if !ok {
+		return
+	}
+	cost := time.Since(v.(time.Time))
+	ctx := stmt.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// 参数中可能有密码、手机号等，不代入语句
+	sql := stmt.SQL.String() + " args:" + strconv.Itoa(len(stmt.Vars))
+	if values {
+		sql = tx.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)
+	}
+	switch {
+	case tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound):
+		log.CtxWarnf(ctx, "sql:%s table:%s rows:%d cost:%v err:%v", sql, stmt.Table, tx.RowsAffected, cost, tx.Error)
+	case slow > 0 && cost > slow:
+		log.CtxWarnf(ctx, "slow sql:%s table:%s rows:%d cost:%v", sql, stmt.Table, tx.RowsAffected, cost)
+	case isShowSql(ctx):
+		log.CtxInfof(ctx, "sql:%s table:%s rows:%d cost:%v", sql, stmt.Table, tx.RowsAffected, cost)
+	default:
+		log.CtxDebugf(ctx, "sql:%s table:%s rows:%d cost:%v", sql, stmt.Table, tx.RowsAffected, cost)
+	}
+}
@@ -0,0 +1,66 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cylScripter/chest/log"
+)
+
+type ModelLogItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestSqlLog(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelLogItem{}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	item := NewModel(&ModelConfig{Type: &ModelLogItem{}}, orm)
+	if err := item.NewScope().ShowSql().Create(ctx, &ModelLogItem{Name: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "[Info] sql:INSERT INTO `dbx_log_item`") || !strings.Contains(out, "table:dbx_log_item rows:1") {
+		t.Errorf("unexpected log %q", out)
+	}
+	// 默认不打印参数值
+	if strings.Contains(out, "secret") || !strings.Contains(out, "?") || !strings.Contains(out, " args:2 ") {
+		t.Errorf("expected placeholders and arg count only, got %q", out)
+	}
+	buf.Reset()
+	var list []*ModelLogItem
+	if err := item.NewScope().Find(ctx, &list); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("debug sql should be filtered by level, got %q", buf.String())
+	}
+
+	slowDb, err := NewDb(DbConfig{
+		DbName:        "file:dbx_test?mode=memory&cache=shared",
+		DbType:        "sqlite",
+		SlowThreshold: time.Nanosecond,
+		LogSqlValues:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slowDb.Close()
+	if err = NewModel(&ModelConfig{Type: &ModelLogItem{}}, slowDb).Where("name", "a").Find(ctx, &list); err != nil {
+		t.Fatal(err)
+	}
+	if out = buf.String(); !strings.Contains(out, "[Warn] slow sql:SELECT") || !strings.Contains(out, "`name` = \"a\"") {
+		t.Errorf("unexpected slow log %q", out)
+	}
+}
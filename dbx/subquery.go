@@ -0,0 +1,220 @@
+package dbx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToExpr 把 Scope 渲染成 SELECT 子查询，带上自己的软删除过滤，用作 Where 的值或 WhereExists 的参数。
+// 没有 Select 时查 id；字段都加上表名（或 As 设置的别名），不会被外层查询的 Join 改写；
+// 表名按子查询自己的 Db 路由，带上它的库名前缀，与外层查询不共用连接时外层查询返回错误。
+// 条件或排序无效时返回错误，作为条件的值时错误记在外层的 Cond 上，由外层查询返回
+func (s *Scope) ToExpr() (Expr, error) {
+	if err := s.condErr(); err != nil {
+		return Expr{}, err
+	}
+	q := s.alias
+	if q == "" {
+		q = s.GetTableName()
+		if idx := strings.LastIndexByte(q, '.'); idx >= 0 {
+			q = q[idx+1:]
+		}
+	}
+	var args []interface{}
+	selects := []string{quoteFieldName(q + ".id")}
+	if len(s.selects) > 0 {
+		selects = qualifyColumns(s.selects, q)
+	}
+	table, err := s.physicalTable()
+	if err != nil {
+		return Expr{}, err
+	}
+	from := quoteFieldName(table)
+	if s.alias != "" || table != s.GetTableName() {
+		from = fmt.Sprintf("%s AS %s", from, quoteFieldName(q))
+	}
+	sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selects, ","), from)
+	for _, j := range s.joins {
+		sql += " " + j.Sql
+		args = append(args, j.Args...)
+	}
+	req := &WhereReq{
+		Unscoped:    s.unscoped,
+		OnlyTrashed: s.onlyTrashed,
+		SoftDelete:  s.m.SoftDelete,
+		Alias:       q,
+	}
+	var wheres []string
+	for _, e := range req.softDeleteCond() {
+		wheres = append(wheres, e.Sql)
+		args = append(args, e.Args...)
+	}
+	if e := s.cond.ToExpr(); e.Sql != "" {
+		wheres = append(wheres, "("+qualifyIdentifiers(e.Sql, q)+")")
+		args = append(args, e.Args...)
+	}
+	if len(wheres) > 0 {
+		sql += " WHERE " + strings.Join(wheres, " AND ")
+	}
+	if len(s.groups) > 0 {
+		sql += " GROUP BY " + strings.Join(qualifyColumns(strings.Split(strings.Join(s.groups, ","), ","), q), ",")
+		if e := s.having.ToExpr(); e.Sql != "" {
+			sql += " HAVING " + e.Sql
+			args = append(args, e.Args...)
+		}
+	}
+	if s.limit > 0 {
+		terms, err := s.orderFields()
+		if err != nil {
+			return Expr{}, err
+		}
+		if orders, orderArgs := renderOrders(terms, q); len(orders) > 0 {
+			sql += " ORDER BY " + strings.Join(orders, ",")
+			args = append(args, orderArgs...)
+		}
+		sql += fmt.Sprintf(" LIMIT %d", s.limit)
+		if s.offset > 0 {
+			sql += fmt.Sprintf(" OFFSET %d", s.offset)
+		}
+	}
+	return Expr{Sql: sql, Args: args}, nil
+}
+
+// WhereExists 加上 EXISTS (子查询) 条件，子查询中引用外层表的字段时写成 sql，如 "o.user_id = u.id"
+func (s *Scope) WhereExists(sub *Scope) *Scope {
+	e := s.cond.subExpr(sub)
+	s.cond.whereRaw(fmt.Sprintf("EXISTS (%s)", e.Sql), e.Args...)
+	return s
+}
+
+// WhereNotExists 加上 NOT EXISTS (子查询) 条件，见 WhereExists
+func (s *Scope) WhereNotExists(sub *Scope) *Scope {
+	e := s.cond.subExpr(sub)
+	s.cond.whereRaw(fmt.Sprintf("NOT EXISTS (%s)", e.Sql), e.Args...)
+	return s
+}
+
+func (p *Model) WhereExists(sub *Scope) *Scope {
+	return p.NewScope().WhereExists(sub)
+}
+
+func (p *Model) WhereNotExists(sub *Scope) *Scope {
+	return p.NewScope().WhereNotExists(sub)
+}
+
+// condErr 构造 Where/Having/Join 条件时记下的错误，以及条件中的子查询与当前查询不在同一个连接上的错误，执行查询前检查
+func (s *Scope) condErr() error {
+	for _, c := range []*Cond{&s.cond, &s.having} {
+		if c.err != nil {
+			return c.err
+		}
+	}
+	for _, c := range []*Cond{&s.cond, &s.having} {
+		for _, sub := range c.subs {
+			if err := s.checkSubDb(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dbRouter 能按逻辑库名找到执行语句的 Db 的 DbProxy：Db、Registry 和包装它们的拦截器
+type dbRouter interface {
+	routeDb(name string) (*Db, error)
+}
+
+func (p *Db) routeDb(string) (*Db, error) {
+	return p, nil
+}
+
+func (r *Registry) routeDb(name string) (*Db, error) {
+	return r.Use(name)
+}
+
+func (p *interceptProxy) routeDb(name string) (*Db, error) {
+	return routeDb(p.next, name)
+}
+
+// routeDb proxy 上逻辑库 name 对应的 Db，proxy 不能路由（如 dbxtest 的替身）时返回 nil
+func routeDb(proxy DbProxy, name string) (*Db, error) {
+	if r, ok := proxy.(dbRouter); ok {
+		return r.routeDb(name)
+	}
+	return nil, nil
+}
+
+// physicalTable 子查询中的表名，带上 Scope 所在库的前缀（Registry 中与其他库共用连接时）
+func (s *Scope) physicalTable() (string, error) {
+	table := s.GetTableName()
+	db, err := routeDb(s.m.proxy, s.db)
+	if err != nil || db == nil {
+		return table, err
+	}
+	return db.tableName(table, nil), nil
+}
+
+// checkSubDb 子查询要与外层查询在同一个连接上执行，否则读到的是外层库里的表
+func (s *Scope) checkSubDb(sub *Scope) error {
+	outer, err := routeDb(s.m.proxy, s.db)
+	if err != nil {
+		return err
+	}
+	inner, err := routeDb(sub.m.proxy, sub.db)
+	if err != nil {
+		return err
+	}
+	if outer == nil || inner == nil || outer.db == inner.db {
+		return nil
+	}
+	return fmt.Errorf("subquery on %s runs on db %s, which does not share a connection with %s", sub.GetTableName(), inner.config.DbName, s.GetTableName())
+}
+
+// subExpr 渲染作为条件的子查询，出错时记在 p 上
+func (p *Cond) subExpr(sub *Scope) Expr {
+	e, err := sub.ToExpr()
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("subquery on %s: %w", sub.GetTableName(), err)
+	}
+	p.subs = append(p.subs, sub)
+	return e
+}
+
+// expandSubQueries 把 sql 中对应 *Scope 参数的 ? 换成子查询，单引号内的 ? 不处理
+func (p *Cond) expandSubQueries(sql string, values []interface{}) (string, []interface{}) {
+	hasSub := false
+	for _, v := range values {
+		if _, ok := v.(*Scope); ok {
+			hasSub = true
+			break
+		}
+	}
+	if !hasSub {
+		return sql, values
+	}
+	var b strings.Builder
+	var args []interface{}
+	inStr := false
+	idx := 0
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		if c == '\'' {
+			inStr = !inStr
+		}
+		if c != '?' || inStr || idx >= len(values) {
+			b.WriteByte(c)
+			continue
+		}
+		if sub, ok := values[idx].(*Scope); ok {
+			e := p.subExpr(sub)
+			b.WriteString("(" + e.Sql + ")")
+			args = append(args, e.Args...)
+		} else {
+			b.WriteByte(c)
+			args = append(args, values[idx])
+		}
+		idx++
+	}
+	args = append(args, values[idx:]...)
+	return b.String(), args
+}
@@ -0,0 +1,107 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type ModelSubUser struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+type ModelSubOrder struct {
+	Id        int32 `json:"id"`
+	UserId    int32 `json:"user_id"`
+	Amount    int32 `json:"amount"`
+	DeletedAt int32 `json:"deleted_at"`
+}
+
+func TestSubQueryExpr(t *testing.T) {
+	order := NewModel(&ModelConfig{Type: &ModelSubOrder{}}, nil)
+	user := NewModel(&ModelConfig{Type: &ModelSubUser{}}, nil)
+	s := user.Where("id", "IN", order.Select("user_id").Where("amount", ">", 10)).Where("name", "!=", "x")
+	e := s.cond.ToExpr()
+	want := "(`id` IN (SELECT `dbx_sub_order`.`user_id` FROM `dbx_sub_order` WHERE `dbx_sub_order`.`deleted_at` = 0 AND ((`dbx_sub_order`.`amount` > ?)))) AND (`name` != ?)"
+	if e.Sql != want {
+		t.Errorf("sql %q, want %q", e.Sql, want)
+	}
+	if !reflect.DeepEqual(e.Args, []interface{}{10, "x"}) {
+		t.Errorf("args %v", e.Args)
+	}
+	raw := user.Where("id IN ? OR name = ?", order.Select("user_id"), "y").cond.ToExpr()
+	if raw.Sql != "(id IN (SELECT `dbx_sub_order`.`user_id` FROM `dbx_sub_order` WHERE `dbx_sub_order`.`deleted_at` = 0) OR name = ?)" || !reflect.DeepEqual(raw.Args, []interface{}{"y"}) {
+		t.Errorf("unexpected raw expr %q %v", raw.Sql, raw.Args)
+	}
+}
+
+func TestSubQuery(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelSubUser{}, &ModelSubOrder{}); err != nil {
+		t.Fatal(err)
+	}
+	user := NewModel(&ModelConfig{Type: &ModelSubUser{}}, orm)
+	order := NewModel(&ModelConfig{Type: &ModelSubOrder{}}, orm)
+	for _, u := range []*ModelSubUser{{Id: 1, Name: "a"}, {Id: 2, Name: "b"}, {Id: 3, Name: "c"}} {
+		if err := user.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, o := range []*ModelSubOrder{{Id: 1, UserId: 1, Amount: 5}, {Id: 2, UserId: 2, Amount: 50}, {Id: 3, UserId: 3, Amount: 60, DeletedAt: 1}} {
+		if err := order.Create(ctx, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(s *Scope) []int32 {
+		var list []*ModelSubUser
+		if err := s.OrderAsc("id").Find(ctx, &list); err != nil {
+			t.Fatal(err)
+		}
+		var res []int32
+		for _, v := range list {
+			res = append(res, v.Id)
+		}
+		return res
+	}
+	if got := ids(user.Where("id", "IN", order.Select("user_id").Where("amount", ">", 10))); !reflect.DeepEqual(got, []int32{2}) {
+		t.Errorf("unexpected IN result %v", got)
+	}
+	if got := ids(user.NewScope().As("u").WhereNotExists(order.NewScope().As("o").Where("o.user_id = u.id"))); !reflect.DeepEqual(got, []int32{3}) {
+		t.Errorf("unexpected NOT EXISTS result %v", got)
+	}
+	if got := ids(user.WhereExists(order.Unscoped().Where("dbx_sub_order.user_id = dbx_sub_user.id").Where("amount", ">", 55))); !reflect.DeepEqual(got, []int32{3}) {
+		t.Errorf("unexpected EXISTS result %v", got)
+	}
+}
+
+func TestSubQueryInvalidOrder(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelSubUser{}, &ModelSubOrder{}); err != nil {
+		t.Fatal(err)
+	}
+	user := NewModel(&ModelConfig{Type: &ModelSubUser{}}, orm)
+	order := NewModel(&ModelConfig{Type: &ModelSubOrder{}}, orm)
+	bad := func() *Scope {
+		return order.Select("user_id").OrderDesc("no_such_column").SetLimit(1)
+	}
+	if _, err := bad().ToExpr(); !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("expected ErrInvalidOrder from ToExpr, got %v", err)
+	}
+	var list []*ModelSubUser
+	if err := user.Where("id", "IN", bad()).Find(ctx, &list); !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("expected ErrInvalidOrder from Find, got %v", err)
+	}
+	if _, err := user.Where("id IN ?", bad()).Count(ctx); !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("expected ErrInvalidOrder from Count, got %v", err)
+	}
+	if _, err := user.WhereExists(bad()).Delete(ctx); !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("expected ErrInvalidOrder from Delete, got %v", err)
+	}
+	nested := order.Where("user_id", "IN", user.Select("id").Where("name", "x").OrWhere("id", "IN", bad()))
+	if err := nested.Find(ctx, &[]*ModelSubOrder{}); !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("expected ErrInvalidOrder from nested subquery, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrTimeout 语句超过 Scope.Timeout、DbConfig.StatementTimeout 或 ctx 的截止时间，
+// 返回的错误满足 errors.Is(err, ErrTimeout)，同时包含驱动返回的原始错误
+var ErrTimeout = errors.New("dbx: statement timeout")
+
+const timeoutCancelKey = "dbx:timeout_cancel"
+
+type timeoutKey struct{}
+
+// WithTimeout ctx 上执行的每条语句的超时时间，覆盖 DbConfig.StatementTimeout，<=0 时不限制
+func WithTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, d)
+}
+
+// Timeout 本次调用的每条语句的超时时间，覆盖 DbConfig.StatementTimeout，超时返回 ErrTimeout
+func (s *Scope) Timeout(d time.Duration) *Scope {
+	s.timeout = d
+	return s
+}
+
+// callCtx 调用 DbProxy 时用的 ctx，带上 ShowSql 和 Timeout 的设置
+func (s *Scope) callCtx(ctx context.Context) context.Context {
+	if s.showSql {
+		ctx = WithShowSql(ctx)
+	}
+	if s.timeout != 0 {
+		ctx = WithTimeout(ctx, s.timeout)
+	}
+	return ctx
+}
+
+// registerTimeout 给增删改查语句加上超时，包住整个 gorm 处理流程（含默认事务），结束后释放。
+// Rows 的结果在语句返回后才读取，超时由 Db.Rows 加上并持续到 Rows.Close
+func registerTimeout(db *gorm.DB, def time.Duration) error {
+	before := func(tx *gorm.DB) {
+		ctx, cancel := withStatementTimeout(tx.Statement.Context, def)
+		tx.Statement.Context = ctx
+		tx.InstanceSet(timeoutCancelKey, cancel)
+	}
+	after := func(tx *gorm.DB) {
+		if v, ok := tx.InstanceGet(timeoutCancelKey); ok {
+			defer v.(context.CancelFunc)()
+		}
+		tx.Error = wrapTimeout(tx.Statement.Context, tx.Error)
+	}
+	cb := db.Callback()
+	regs := []error{
+		cb.Create().Before("*").Register("dbx:timeout", before),
+		cb.Create().After("*").Register("dbx:timeout_done", after),
+		cb.Query().Before("*").Register("dbx:timeout", before),
+		cb.Query().After("*").Register("dbx:timeout_done", after),
+		cb.Update().Before("*").Register("dbx:timeout", before),
+		cb.Update().After("*").Register("dbx:timeout_done", after),
+		cb.Delete().Before("*").Register("dbx:timeout", before),
+		cb.Delete().After("*").Register("dbx:timeout_done", after),
+		cb.Raw().Before("*").Register("dbx:timeout", before),
+		cb.Raw().After("*").Register("dbx:timeout_done", after),
+	}
+	return errors.Join(regs...)
+}
+
+// withStatementTimeout 按 WithTimeout 设置的时间（没有设置时为 def）给 ctx 加上截止时间，不限制时原样返回
+func withStatementTimeout(ctx context.Context, def time.Duration) (context.Context, context.CancelFunc) {
+	d := def
+	if v, ok := ctx.Value(timeoutKey{}).(time.Duration); ok {
+		d = v
+	}
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// wrapTimeout ctx 已超时的错误换成 ErrTimeout
+func wrapTimeout(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrTimeout) || ctx == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrTimeout, err)
+}
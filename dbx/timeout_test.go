@@ -0,0 +1,74 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type ModelTimeoutItem struct {
+	Id        int32 `json:"id"`
+	DeletedAt int32 `json:"deleted_at"`
+}
+
+func TestTimeout(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelTimeoutItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelTimeoutItem{}}, orm)
+	var list []*ModelTimeoutItem
+	if err := item.NewScope().Timeout(time.Nanosecond).Find(ctx, &list); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if err := item.NewScope().Timeout(time.Minute).Find(ctx, &list); err != nil {
+		t.Errorf("unexpected err %v", err)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := item.NewScope().Find(cctx, &list); !errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeout) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	db, err := NewDb(DbConfig{
+		DbName:           "file:dbx_test?mode=memory&cache=shared",
+		DbType:           "sqlite",
+		StatementTimeout: time.Nanosecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m := NewModel(&ModelConfig{Type: &ModelTimeoutItem{}}, db)
+	if err = m.Create(ctx, &ModelTimeoutItem{}); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout from default timeout, got %v", err)
+	}
+	if err = m.NewScope().Timeout(time.Minute).Create(ctx, &ModelTimeoutItem{}); err != nil {
+		t.Errorf("unexpected err %v", err)
+	}
+
+	// Rows 的超时覆盖整个遍历过程
+	if _, err = item.NewScope().Timeout(time.Nanosecond).Rows(ctx); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout from rows, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = item.Create(ctx, &ModelTimeoutItem{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := item.NewScope().Timeout(50 * time.Millisecond).Rows(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatalf("expected first row, err %v", rows.Err())
+	}
+	time.Sleep(100 * time.Millisecond)
+	for rows.Next() {
+	}
+	if err = rows.Err(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout while iterating, got %v", err)
+	}
+}
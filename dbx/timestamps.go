@@ -0,0 +1,217 @@
+package dbx
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+var schemaCache = &sync.Map{}
+
+// parseSchema 解析结构体（或它的切片）对应的表结构，列名与 gorm 默认的命名一致
+func parseSchema(dest interface{}) (*schema.Schema, error) {
+	return schema.Parse(dest, schemaCache, schema.NamingStrategy{})
+}
+
+// TimestampUnit 创建和更新时间的存储单位
+type TimestampUnit int
+
+const (
+	// TimestampSecond 整数秒时间戳
+	TimestampSecond TimestampUnit = iota
+	// TimestampMilli 整数毫秒时间戳
+	TimestampMilli
+	// TimestampDatetime datetime
+	TimestampDatetime
+)
+
+// Timestamps 自动写入创建和更新时间，在 ModelConfig 中按表配置，零值为 created_at/updated_at 整数秒，
+// 模型上没有的列不写。gorm 对名为 CreatedAt/UpdatedAt 的字段会按字段类型自己补时间，
+// 单位与 Unit 不同时需要在字段上加 autoCreateTime/autoUpdateTime 标签；Disable 或 SkipTimestamps 时 gorm 也不补
+type Timestamps struct {
+	// CreatedColumn 默认 created_at
+	CreatedColumn string
+	// UpdatedColumn 默认 updated_at
+	UpdatedColumn string
+	Unit          TimestampUnit
+	// Disable 不自动写入
+	Disable bool
+}
+
+func (t Timestamps) createdColumn() string {
+	if t.CreatedColumn != "" {
+		return t.CreatedColumn
+	}
+	return "created_at"
+}
+
+func (t Timestamps) updatedColumn() string {
+	if t.UpdatedColumn != "" {
+		return t.UpdatedColumn
+	}
+	return "updated_at"
+}
+
+func (t Timestamps) now() interface{} {
+	now := time.Now()
+	switch t.Unit {
+	case TimestampMilli:
+		return now.UnixMilli()
+	case TimestampDatetime:
+		return now
+	default:
+		return now.Unix()
+	}
+}
+
+// SkipTimestamps 本次调用不自动写入创建和更新时间，包括 gorm 自动补的 CreatedAt/UpdatedAt。
+// 零值的时间列不写入（插入时为列的默认值，Save 时保留已有的值），非零值按原值写入；
+// 批量插入时只有所有行都为零值的列才不写入
+func (s *Scope) SkipTimestamps() *Scope {
+	s.skipTimestamps = true
+	return s
+}
+
+func (s *Scope) timestamps() (Timestamps, bool) {
+	t := s.m.Timestamps
+	return t, !t.Disable && !s.skipTimestamps
+}
+
+// stamp 给 dest（结构体指针或结构体切片）写入时间，已有的创建时间保留，update 为 false 时已有的更新时间也保留
+func (s *Scope) stamp(ctx context.Context, dest interface{}, update bool) error {
+	t, ok := s.timestamps()
+	if !ok {
+		return nil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(dest))
+	if rv.Kind() != reflect.Struct && rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	sch, err := parseSchema(dest)
+	if err != nil {
+		// map 等非结构体的 dest 不处理
+		return nil
+	}
+	created := sch.LookUpField(t.createdColumn())
+	updated := sch.LookUpField(t.updatedColumn())
+	if created == nil && updated == nil {
+		return nil
+	}
+	now := t.now()
+	set := func(row reflect.Value) error {
+		row = reflect.Indirect(row)
+		if created != nil {
+			if _, isZero := created.ValueOf(ctx, row); isZero {
+				if err := created.Set(ctx, row, now); err != nil {
+					return err
+				}
+			}
+		}
+		if updated != nil {
+			if _, isZero := updated.ValueOf(ctx, row); isZero || update {
+				if err := updated.Set(ctx, row, now); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if rv.Kind() == reflect.Struct {
+		return set(rv)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err = set(rv.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stampValues 模型上有更新时间列且 values 中没有时，返回加上更新时间的新 map
+func (s *Scope) stampValues(values map[string]interface{}) map[string]interface{} {
+	t, ok := s.timestamps()
+	if !ok {
+		return values
+	}
+	col := t.updatedColumn()
+	if _, exists := values[col]; exists {
+		return values
+	}
+	sch, err := parseSchema(s.m.getModel())
+	if err != nil || sch.LookUpField(col) == nil {
+		return values
+	}
+	res := make(map[string]interface{}, len(values)+1)
+	for k, v := range values {
+		res[k] = v
+	}
+	res[col] = t.now()
+	return res
+}
+
+// stampColumns upsert 冲突时更新的列加上更新时间列
+func (s *Scope) stampColumns(dest interface{}, updateColumns []string) []string {
+	t, ok := s.timestamps()
+	if !ok || len(updateColumns) == 0 {
+		return updateColumns
+	}
+	col := t.updatedColumn()
+	for _, c := range updateColumns {
+		if c == col {
+			return updateColumns
+		}
+	}
+	sch, err := parseSchema(dest)
+	if err != nil || sch.LookUpField(col) == nil {
+		return updateColumns
+	}
+	return append(append([]string{}, updateColumns...), col)
+}
+
+// autoTimeOmits 不自动写入时间时，dest 中所有行都为零值的 gorm 自动时间列（autoCreateTime/autoUpdateTime），
+// 写入时省略，避免 gorm 给它们补上当前时间
+func (s *Scope) autoTimeOmits(ctx context.Context, dest interface{}) []string {
+	if _, ok := s.timestamps(); ok {
+		return nil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(dest))
+	if rv.Kind() != reflect.Struct && rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	sch, err := parseSchema(dest)
+	if err != nil {
+		return nil
+	}
+	var omits []string
+	for _, field := range sch.Fields {
+		if field.DBName == "" || (field.AutoCreateTime == 0 && field.AutoUpdateTime == 0) {
+			continue
+		}
+		if allZero(ctx, field, rv) {
+			omits = append(omits, field.DBName)
+		}
+	}
+	return omits
+}
+
+func allZero(ctx context.Context, field *schema.Field, rv reflect.Value) bool {
+	if rv.Kind() == reflect.Struct {
+		_, isZero := field.ValueOf(ctx, rv)
+		return isZero
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if _, isZero := field.ValueOf(ctx, reflect.Indirect(rv.Index(i))); !isZero {
+			return false
+		}
+	}
+	return true
+}
+
+// skipAutoTime 不自动写入时间时 Update/Save 也不让 gorm 写入自动更新时间
+func (s *Scope) skipAutoTime() bool {
+	_, ok := s.timestamps()
+	return !ok
+}
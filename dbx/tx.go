@@ -0,0 +1,62 @@
+package dbx
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// txCtxKey 按连接区分 ctx 中的事务句柄，避免把一个连接上的事务用到另一个连接上；
+// Registry 中同一台服务器上的库共用连接，因此也共用事务
+type txCtxKey struct {
+	db *gorm.DB
+}
+
+type txHandle struct {
+	tx *gorm.DB
+	// 事务中写过的表，最外层事务提交后再让这些表的缓存失效，嵌套事务共用同一个
+	dirty map[dirtyTable]struct{}
+}
+
+type dirtyTable struct {
+	db    *Db
+	table string
+}
+
+// Transaction 在事务中执行 fn，fn 返回 error 或 panic 时回滚，否则提交。
+// 事务句柄挂在传给 fn 的 ctx 上，fn 内用这个 ctx 调用任意 Model/Scope 的方法都会走同一个事务；
+// 在事务内再次调用 Transaction 时使用 savepoint，内层失败只回滚到 savepoint
+func (p *Db) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	parent := p.txHandle(ctx)
+	dirty := map[dirtyTable]struct{}{}
+	if parent != nil {
+		dirty = parent.dirty
+	}
+	err := p.session(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txCtxKey{db: p.db}, &txHandle{tx: tx, dirty: dirty}))
+	})
+	if err == nil && parent == nil {
+		for t := range dirty {
+			t.db.bumpCacheVersion(t.table)
+		}
+	}
+	return err
+}
+
+// InTransaction ctx 是否带有当前 Db 所在连接的事务
+func (p *Db) InTransaction(ctx context.Context) bool {
+	return p.txHandle(ctx) != nil
+}
+
+func (p *Db) txHandle(ctx context.Context) *txHandle {
+	h, _ := ctx.Value(txCtxKey{db: p.db}).(*txHandle)
+	return h
+}
+
+// session 返回 ctx 中的事务句柄，不在事务中时返回共享的 *gorm.DB，语句带上 ctx
+func (p *Db) session(ctx context.Context) *gorm.DB {
+	if h := p.txHandle(ctx); h != nil {
+		return h.tx.WithContext(ctx)
+	}
+	return p.db.WithContext(ctx)
+}
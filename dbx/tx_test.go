@@ -0,0 +1,104 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type ModelTxItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestTransaction(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelTxItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewModel(&ModelConfig{Type: &ModelTxItem{}}, orm)
+	names := func() []string {
+		var list []*ModelTxItem
+		if err := item.NewScope().OrderAsc("id").Find(ctx, &list); err != nil {
+			t.Fatal(err)
+		}
+		var res []string
+		for _, v := range list {
+			res = append(res, v.Name)
+		}
+		return res
+	}
+
+	// 提交
+	err := orm.Transaction(ctx, func(ctx context.Context) error {
+		if !orm.InTransaction(ctx) {
+			t.Errorf("expected ctx in transaction")
+		}
+		return item.Create(ctx, &ModelTxItem{Name: "commit"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); len(got) != 1 || got[0] != "commit" {
+		t.Errorf("unexpected rows after commit %v", got)
+	}
+
+	// fn 返回 error 时回滚
+	fail := errors.New("fail")
+	err = orm.Transaction(ctx, func(ctx context.Context) error {
+		if err := item.Create(ctx, &ModelTxItem{Name: "error"}); err != nil {
+			return err
+		}
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Errorf("expected fail, got %v", err)
+	}
+	if got := names(); len(got) != 1 {
+		t.Errorf("expected rollback on error, got %v", got)
+	}
+
+	// panic 时回滚并继续 panic
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("expected panic to propagate, got %v", r)
+			}
+		}()
+		_ = orm.Transaction(ctx, func(ctx context.Context) error {
+			if err := item.Create(ctx, &ModelTxItem{Name: "panic"}); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+	if got := names(); len(got) != 1 {
+		t.Errorf("expected rollback on panic, got %v", got)
+	}
+
+	// 嵌套事务失败只回滚到 savepoint，外层继续提交
+	err = orm.Transaction(ctx, func(ctx context.Context) error {
+		if err := item.Create(ctx, &ModelTxItem{Name: "outer"}); err != nil {
+			return err
+		}
+		inner := orm.Transaction(ctx, func(ctx context.Context) error {
+			if err := item.Create(ctx, &ModelTxItem{Name: "inner"}); err != nil {
+				return err
+			}
+			return fail
+		})
+		if !errors.Is(inner, fail) {
+			t.Errorf("expected inner fail, got %v", inner)
+		}
+		return orm.Transaction(ctx, func(ctx context.Context) error {
+			return item.Create(ctx, &ModelTxItem{Name: "nested"})
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); len(got) != 3 || got[1] != "outer" || got[2] != "nested" {
+		t.Errorf("unexpected rows after nested transactions %v", got)
+	}
+}
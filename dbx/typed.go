@@ -0,0 +1,390 @@
+package dbx
+
+import (
+	"context"
+	"time"
+
+	"github.com/cylScripter/openapi/base"
+)
+
+// TypedModel 按模型类型 T 查询，结果直接返回 []*T/*T，T 为结构体类型（不是指针）。
+// 嵌入的 *Model 保留原来的 interface{} 接口，TypedModel 的同名方法改为类型化的版本，需要时用 m.Model 调用原方法
+type TypedModel[T any] struct {
+	*Model
+}
+
+// NewTypedModel 创建 T 对应的 TypedModel，c.Type 为空时使用 T，如
+// users := dbx.NewTypedModel[ModelUser](&dbx.ModelConfig{Db: "user"}, registry)
+func NewTypedModel[T any](c *ModelConfig, proxy DbProxy) *TypedModel[T] {
+	cfg := ModelConfig{}
+	if c != nil {
+		cfg = *c
+	}
+	if cfg.Type == nil {
+		cfg.Type = new(T)
+	}
+	return &TypedModel[T]{Model: NewModel(&cfg, proxy)}
+}
+
+func (p *TypedModel[T]) NewScope() *TypedScope[T] {
+	return &TypedScope[T]{s: p.Model.NewScope()}
+}
+
+func (p *TypedModel[T]) Where(whereCond ...interface{}) *TypedScope[T] {
+	return &TypedScope[T]{s: p.Model.Where(whereCond...)}
+}
+
+func (p *TypedModel[T]) OrWhere(whereCond ...interface{}) *TypedScope[T] {
+	return &TypedScope[T]{s: p.Model.OrWhere(whereCond...)}
+}
+
+func (p *TypedModel[T]) Select(fields ...string) *TypedScope[T] {
+	return &TypedScope[T]{s: p.Model.Select(fields...)}
+}
+
+func (p *TypedModel[T]) UnScoped() *TypedScope[T] {
+	return &TypedScope[T]{s: p.Model.UnScoped()}
+}
+
+func (p *TypedModel[T]) OnlyTrashed() *TypedScope[T] {
+	return &TypedScope[T]{s: p.Model.OnlyTrashed()}
+}
+
+func (p *TypedModel[T]) Unscoped() *TypedScope[T] {
+	return &TypedScope[T]{s: p.Model.Unscoped()}
+}
+
+func (p *TypedModel[T]) WithTrash() *TypedScope[T] {
+	return &TypedScope[T]{s: p.Model.WithTrash()}
+}
+
+func (p *TypedModel[T]) WhereExists(sub *Scope) *TypedScope[T] {
+	return &TypedScope[T]{s: p.Model.WhereExists(sub)}
+}
+
+func (p *TypedModel[T]) WhereNotExists(sub *Scope) *TypedScope[T] {
+	return &TypedScope[T]{s: p.Model.WhereNotExists(sub)}
+}
+
+func (p *TypedModel[T]) Create(ctx context.Context, obj *T) error {
+	return p.Model.Create(ctx, obj)
+}
+
+func (p *TypedModel[T]) Save(ctx context.Context, obj *T) error {
+	return p.Model.Save(ctx, obj)
+}
+
+// Upsert 见 Scope.Upsert
+func (p *TypedModel[T]) Upsert(ctx context.Context, obj *T, conflictColumns []string, updateColumns []string) (UpdateOrCreateResult, error) {
+	return p.Model.Upsert(ctx, obj, conflictColumns, updateColumns)
+}
+
+// FirstOrCreate 见 Scope.FirstOrCreate，查到或创建的行写入 obj
+func (p *TypedModel[T]) FirstOrCreate(ctx context.Context, attributes map[string]interface{}, values map[string]interface{}, obj *T) (FirstOrCreateResult, error) {
+	return p.Model.FirstOrCreate(ctx, attributes, values, obj)
+}
+
+// FirstOrUpdate 见 Scope.FirstOrUpdate，更新后的行写入 obj
+func (p *TypedModel[T]) FirstOrUpdate(ctx context.Context, attributes map[string]interface{}, values map[string]interface{}, obj *T) (FirstOrCreateResult, error) {
+	return p.Model.FirstOrUpdate(ctx, attributes, values, obj)
+}
+
+// TypedScope 类型化的 Scope，链式方法与 Scope 的同名方法相同，返回自身；
+// 没有包装的方法通过 Scope() 取得底层的 Scope 调用，条件在两者之间共享
+type TypedScope[T any] struct {
+	s *Scope
+}
+
+// Scope 底层的 Scope
+func (t *TypedScope[T]) Scope() *Scope {
+	return t.s
+}
+
+func (t *TypedScope[T]) Where(args ...interface{}) *TypedScope[T] {
+	t.s.Where(args...)
+	return t
+}
+
+func (t *TypedScope[T]) OrWhere(args ...interface{}) *TypedScope[T] {
+	t.s.OrWhere(args...)
+	return t
+}
+
+func (t *TypedScope[T]) WhereIn(fieldName string, list interface{}) *TypedScope[T] {
+	t.s.WhereIn(fieldName, list)
+	return t
+}
+
+func (t *TypedScope[T]) WhereNotIn(fieldName string, list interface{}) *TypedScope[T] {
+	t.s.WhereNotIn(fieldName, list)
+	return t
+}
+
+func (t *TypedScope[T]) WhereExists(sub *Scope) *TypedScope[T] {
+	t.s.WhereExists(sub)
+	return t
+}
+
+func (t *TypedScope[T]) WhereNotExists(sub *Scope) *TypedScope[T] {
+	t.s.WhereNotExists(sub)
+	return t
+}
+
+func (t *TypedScope[T]) Lt(f string, v interface{}) *TypedScope[T] {
+	t.s.Lt(f, v)
+	return t
+}
+
+func (t *TypedScope[T]) Lte(f string, v interface{}) *TypedScope[T] {
+	t.s.Lte(f, v)
+	return t
+}
+
+func (t *TypedScope[T]) Gt(f string, v interface{}) *TypedScope[T] {
+	t.s.Gt(f, v)
+	return t
+}
+
+func (t *TypedScope[T]) Gte(f string, v interface{}) *TypedScope[T] {
+	t.s.Gte(f, v)
+	return t
+}
+
+func (t *TypedScope[T]) Select(fields ...string) *TypedScope[T] {
+	t.s.Select(fields...)
+	return t
+}
+
+func (t *TypedScope[T]) Omit(columns ...string) *TypedScope[T] {
+	t.s.Omit(columns...)
+	return t
+}
+
+func (t *TypedScope[T]) As(alias string) *TypedScope[T] {
+	t.s.As(alias)
+	return t
+}
+
+func (t *TypedScope[T]) Join(table string, on ...interface{}) *TypedScope[T] {
+	t.s.Join(table, on...)
+	return t
+}
+
+func (t *TypedScope[T]) LeftJoin(table string, on ...interface{}) *TypedScope[T] {
+	t.s.LeftJoin(table, on...)
+	return t
+}
+
+func (t *TypedScope[T]) RightJoin(table string, on ...interface{}) *TypedScope[T] {
+	t.s.RightJoin(table, on...)
+	return t
+}
+
+func (t *TypedScope[T]) OrderAsc(fields ...string) *TypedScope[T] {
+	t.s.OrderAsc(fields...)
+	return t
+}
+
+func (t *TypedScope[T]) OrderDesc(fields ...string) *TypedScope[T] {
+	t.s.OrderDesc(fields...)
+	return t
+}
+
+func (t *TypedScope[T]) OrderExpr(sql string, args ...interface{}) *TypedScope[T] {
+	t.s.OrderExpr(sql, args...)
+	return t
+}
+
+func (t *TypedScope[T]) OrderByField(field string, values ...interface{}) *TypedScope[T] {
+	t.s.OrderByField(field, values...)
+	return t
+}
+
+func (t *TypedScope[T]) NullsFirst() *TypedScope[T] {
+	t.s.NullsFirst()
+	return t
+}
+
+func (t *TypedScope[T]) NullsLast() *TypedScope[T] {
+	t.s.NullsLast()
+	return t
+}
+
+func (t *TypedScope[T]) SortBy(spec string) *TypedScope[T] {
+	t.s.SortBy(spec)
+	return t
+}
+
+func (t *TypedScope[T]) SetLimit(limit uint32) *TypedScope[T] {
+	t.s.SetLimit(limit)
+	return t
+}
+
+func (t *TypedScope[T]) SetOffset(offset uint32) *TypedScope[T] {
+	t.s.SetOffset(offset)
+	return t
+}
+
+func (t *TypedScope[T]) SetCountStrategy(strategy CountStrategy) *TypedScope[T] {
+	t.s.SetCountStrategy(strategy)
+	return t
+}
+
+func (t *TypedScope[T]) Group(fields ...string) *TypedScope[T] {
+	t.s.Group(fields...)
+	return t
+}
+
+func (t *TypedScope[T]) Having(args ...interface{}) *TypedScope[T] {
+	t.s.Having(args...)
+	return t
+}
+
+func (t *TypedScope[T]) Unscoped() *TypedScope[T] {
+	t.s.Unscoped()
+	return t
+}
+
+func (t *TypedScope[T]) OnlyTrashed() *TypedScope[T] {
+	t.s.OnlyTrashed()
+	return t
+}
+
+func (t *TypedScope[T]) UseMaster() *TypedScope[T] {
+	t.s.UseMaster()
+	return t
+}
+
+func (t *TypedScope[T]) UseDb(db string) *TypedScope[T] {
+	t.s.UseDb(db)
+	return t
+}
+
+func (t *TypedScope[T]) UseTable(table string) *TypedScope[T] {
+	t.s.UseTable(table)
+	return t
+}
+
+func (t *TypedScope[T]) EnableCache() *TypedScope[T] {
+	t.s.EnableCache()
+	return t
+}
+
+func (t *TypedScope[T]) ShowSql() *TypedScope[T] {
+	t.s.ShowSql()
+	return t
+}
+
+func (t *TypedScope[T]) Timeout(d time.Duration) *TypedScope[T] {
+	t.s.Timeout(d)
+	return t
+}
+
+func (t *TypedScope[T]) ForUpdate() *TypedScope[T] {
+	t.s.ForUpdate()
+	return t
+}
+
+func (t *TypedScope[T]) ForShare() *TypedScope[T] {
+	t.s.ForShare()
+	return t
+}
+
+func (t *TypedScope[T]) SkipLocked() *TypedScope[T] {
+	t.s.SkipLocked()
+	return t
+}
+
+func (t *TypedScope[T]) NoWait() *TypedScope[T] {
+	t.s.NoWait()
+	return t
+}
+
+func (t *TypedScope[T]) IgnoreConflict() *TypedScope[T] {
+	t.s.IgnoreConflict()
+	return t
+}
+
+func (t *TypedScope[T]) SkipTimestamps() *TypedScope[T] {
+	t.s.SkipTimestamps()
+	return t
+}
+
+// Find 查询符合条件的行，没有时返回空切片
+func (t *TypedScope[T]) Find(ctx context.Context) ([]*T, error) {
+	list := []*T{}
+	if err := t.s.Find(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// First 查询第一行，没有时返回 gorm.ErrRecordNotFound，与 Scope.First 相同
+func (t *TypedScope[T]) First(ctx context.Context) (*T, error) {
+	obj := new(T)
+	if err := t.s.First(ctx, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (t *TypedScope[T]) FindPaginate(ctx context.Context) ([]*T, *base.Paginate, error) {
+	list := []*T{}
+	page, err := t.s.FindPaginate(ctx, &list)
+	if err != nil {
+		return nil, nil, err
+	}
+	return list, page, nil
+}
+
+func (t *TypedScope[T]) FindByCursor(ctx context.Context, cursor string) ([]*T, *CursorPaginate, error) {
+	list := []*T{}
+	page, err := t.s.FindByCursor(ctx, cursor, &list)
+	if err != nil {
+		return nil, nil, err
+	}
+	return list, page, nil
+}
+
+// Chunk 见 Scope.Chunk
+func (t *TypedScope[T]) Chunk(ctx context.Context, size int, fn func(batch []*T) error) error {
+	return t.s.Chunk(ctx, size, func(batch interface{}) error {
+		return fn(batch.([]*T))
+	})
+}
+
+func (t *TypedScope[T]) Count(ctx context.Context) (int64, error) {
+	return t.s.Count(ctx)
+}
+
+func (t *TypedScope[T]) Create(ctx context.Context, obj *T) error {
+	return t.s.Create(ctx, obj)
+}
+
+func (t *TypedScope[T]) CreateInBatches(ctx context.Context, list []*T, batchSize int) (CreateResult, error) {
+	return t.s.CreateInBatches(ctx, list, batchSize)
+}
+
+func (t *TypedScope[T]) Save(ctx context.Context, obj *T) error {
+	return t.s.Save(ctx, obj)
+}
+
+func (t *TypedScope[T]) Upsert(ctx context.Context, obj *T, conflictColumns []string, updateColumns []string) (UpdateOrCreateResult, error) {
+	return t.s.Upsert(ctx, obj, conflictColumns, updateColumns)
+}
+
+func (t *TypedScope[T]) FirstOrCreate(ctx context.Context, attributes map[string]interface{}, values map[string]interface{}, obj *T) (FirstOrCreateResult, error) {
+	return t.s.FirstOrCreate(ctx, attributes, values, obj)
+}
+
+func (t *TypedScope[T]) FirstOrUpdate(ctx context.Context, attributes map[string]interface{}, values map[string]interface{}, obj *T) (FirstOrCreateResult, error) {
+	return t.s.FirstOrUpdate(ctx, attributes, values, obj)
+}
+
+func (t *TypedScope[T]) Update(ctx context.Context, values map[string]interface{}) (UpdateResult, error) {
+	return t.s.Update(ctx, values)
+}
+
+func (t *TypedScope[T]) Delete(ctx context.Context) (DeleteResult, error) {
+	return t.s.Delete(ctx)
+}
@@ -0,0 +1,114 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type ModelTypedItem struct {
+	Id        int32  `json:"id"`
+	Name      string `json:"name"`
+	Kind      int32  `json:"kind"`
+	DeletedAt int32  `json:"deleted_at"`
+}
+
+func TestTypedModel(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelTypedItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewTypedModel[ModelTypedItem](&ModelConfig{}, orm)
+	if item.NewScope().Scope().GetTableName() != "dbx_typed_item" {
+		t.Errorf("unexpected table %s", item.NewScope().Scope().GetTableName())
+	}
+	for i, name := range []string{"a", "b", "c", "d", "e"} {
+		if err := item.Create(ctx, &ModelTypedItem{Name: name, Kind: int32(i % 2)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := item.Where("kind", 0).OrderDesc("id").Find(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Name != "e" || list[2].Name != "a" {
+		t.Errorf("unexpected find %+v", list)
+	}
+	none, err := item.Where("kind", 9).Find(ctx)
+	if err != nil || none == nil || len(none) != 0 {
+		t.Errorf("expected empty slice, got %v %v", none, err)
+	}
+
+	one, err := item.Where("name", "c").First(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.Kind != 0 || one.Id == 0 {
+		t.Errorf("unexpected first %+v", one)
+	}
+	if _, err = item.Where("name", "z").First(ctx); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	page, p, err := item.NewScope().OrderAsc("id").SetOffset(1).SetLimit(2).FindPaginate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].Name != "b" || p.Total != 5 || p.Limit != 2 {
+		t.Errorf("unexpected page %+v %+v", page, p)
+	}
+
+	var names []string
+	err = item.NewScope().Chunk(ctx, 2, func(batch []*ModelTypedItem) error {
+		for _, v := range batch {
+			names = append(names, v.Name)
+		}
+		return nil
+	})
+	if err != nil || len(names) != 5 {
+		t.Errorf("unexpected chunk %v %v", names, err)
+	}
+
+	// 原来的 interface{} 接口仍然可用
+	var raw []*ModelTypedItem
+	if err = item.Model.Where("kind", 1).Find(ctx, &raw); err != nil || len(raw) != 2 {
+		t.Errorf("unexpected untyped find %v %v", raw, err)
+	}
+	if n, err := item.Where("kind", 1).Scope().Count(ctx); err != nil || n != 2 {
+		t.Errorf("unexpected count %d %v", n, err)
+	}
+	sql, err := item.NewScope().RightJoin("dbx_typed_item AS b", "b.id = dbx_typed_item.id").Scope().ToSql(ctx, &raw)
+	if err != nil || !strings.Contains(sql, "RIGHT JOIN") {
+		t.Errorf("unexpected right join sql %s %v", sql, err)
+	}
+}
+
+func TestTypedUpsert(t *testing.T) {
+	ctx := context.Background()
+	if err := orm.AutoMigrate(&ModelUpsertItem{}); err != nil {
+		t.Fatal(err)
+	}
+	item := NewTypedModel[ModelUpsertItem](nil, orm)
+	res, err := item.Upsert(ctx, &ModelUpsertItem{Code: "typed", Name: "n1"}, []string{"code"}, []string{"name"})
+	if err != nil || !res.Created {
+		t.Fatalf("unexpected result %v %v", res, err)
+	}
+	if res, err = item.Upsert(ctx, &ModelUpsertItem{Code: "typed", Name: "n2"}, []string{"code"}, []string{"name"}); err != nil || res.Created {
+		t.Fatalf("unexpected result %v %v", res, err)
+	}
+
+	var obj ModelUpsertItem
+	r, err := item.FirstOrCreate(ctx, map[string]interface{}{"code": "typed"}, map[string]interface{}{"name": "n3"}, &obj)
+	if err != nil || r.Created || obj.Name != "n2" {
+		t.Errorf("unexpected result %v %v %v", r, obj, err)
+	}
+	var updated ModelUpsertItem
+	r, err = item.NewScope().FirstOrUpdate(ctx, map[string]interface{}{"code": "typed"}, map[string]interface{}{"name": "n4"}, &updated)
+	if err != nil || r.Created || updated.Id != obj.Id || updated.Name != "n4" {
+		t.Errorf("unexpected result %v %v %v", r, updated, err)
+	}
+}
@@ -212,7 +212,11 @@ func (ll *defaultLogger) ctxLogf(ctx context.Context, lv Level, format *string,
 	ll.stdlog.SetFlags(log.Lshortfile)
 
 	msg := ""
-	info := rpcinfo.GetRPCInfo(ctx).To()
+	// 不在 rpc 请求中的 ctx 没有 rpcinfo
+	var info rpcinfo.EndpointInfo
+	if ri := rpcinfo.GetRPCInfo(ctx); ri != nil {
+		info = ri.To()
+	}
 
 	if info != nil {
 		if info.ServiceName() != "" {